@@ -0,0 +1,240 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Predefined formats of an AccessLogger. Any other format is parsed as a
+// text/template executed with an *AccessLogEntry.
+const (
+	// AccessLogCommon is the Apache Common Log Format.
+	AccessLogCommon = "common"
+	// AccessLogCombined is the Apache Combined Log Format.
+	AccessLogCombined = "combined"
+	// AccessLogJSON writes one JSON object per line.
+	AccessLogJSON = "json"
+)
+
+// AccessLogEntry describes a request logged by an AccessLogger.
+type AccessLogEntry struct {
+	// Time is when the request was received.
+	Time time.Time
+	// RemoteAddr is the host part of the remote address of the request.
+	RemoteAddr string
+	// User is the user name from basic authentication.
+	User   string
+	Method string
+	URI    string
+	Proto  string
+	Status int
+	// Bytes is the size of the response body as sent, after compression
+	// by MakeGzipHandler.
+	Bytes int64
+	// UncompressedBytes is the size of the response body as written by the
+	// handler, which differs from Bytes if MakeGzipHandler compressed it.
+	UncompressedBytes int64
+	Duration          time.Duration
+	UserAgent         string
+	Referer           string
+	RequestID         string
+
+	compressed bool
+}
+
+// CommonTime returns Time in the format of the Common Log Format.
+func (e *AccessLogEntry) CommonTime() string {
+	return e.Time.Format("02/Jan/2006:15:04:05 -0700")
+}
+
+// RequestLine returns the request line, as logged by the Common Log Format.
+func (e *AccessLogEntry) RequestLine() string {
+	return e.Method + " " + e.URI + " " + e.Proto
+}
+
+// AccessLogger writes a line for every request served by its handlers.
+type AccessLogger struct {
+	// RequestIDHeader is the header carrying the request ID, which is taken
+	// from the response or otherwise the request. X-Request-Id if empty.
+	RequestIDHeader string
+
+	mutex    sync.Mutex
+	writer   io.Writer
+	format   string
+	template *template.Template
+}
+
+type accessLogContextKey struct{}
+
+// NewAccessLogger returns an AccessLogger writing lines to w in format,
+// which is AccessLogCommon, AccessLogCombined, AccessLogJSON or a template
+// such as
+//
+//	{{.RemoteAddr}} {{.Method}} {{.URI}} {{.Status}} {{.Duration}}
+//
+// Lines are terminated with a newline if the template does not do so.
+func NewAccessLogger(w io.Writer, format string) (*AccessLogger, error) {
+	l := &AccessLogger{writer: w, format: format}
+	switch format {
+	case AccessLogCommon, AccessLogCombined, AccessLogJSON:
+	default:
+		t, err := template.New("accesslog").Parse(format)
+		if err != nil {
+			return nil, err
+		}
+		l.template = t
+	}
+	return l, nil
+}
+
+// Handler returns a handler which runs h and logs its responses.
+//
+// To log compressed and uncompressed sizes, MakeGzipHandler needs to run
+// inside of the returned handler.
+func (l *AccessLogger) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := &AccessLogEntry{
+			Time:      time.Now(),
+			Method:    r.Method,
+			URI:       r.RequestURI,
+			Proto:     r.Proto,
+			UserAgent: r.UserAgent(),
+			Referer:   r.Referer(),
+		}
+		if entry.URI == "" {
+			entry.URI = r.URL.RequestURI()
+		}
+		entry.RemoteAddr = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			entry.RemoteAddr = host
+		}
+		entry.User, _, _ = r.BasicAuth()
+
+		lw := &accessLogWriter{statusWriter: statusWriter{ResponseWriter: w}}
+		defer func() {
+			entry.Duration = time.Since(entry.Time)
+			entry.Status = lw.Status()
+			if entry.Status == 0 {
+				// The server sends 200 for handlers writing nothing,
+				// hijacked connections are logged as 101 instead.
+				entry.Status = http.StatusOK
+			}
+			entry.Bytes = lw.written
+			if !entry.compressed {
+				entry.UncompressedBytes = entry.Bytes
+			}
+			entry.RequestID = w.Header().Get(l.requestIDHeader())
+			if entry.RequestID == "" {
+				entry.RequestID = r.Header.Get(l.requestIDHeader())
+			}
+			l.Log(entry)
+		}()
+		h.ServeHTTP(exposeOptionalInterfaces(lw), r.WithContext(context.WithValue(r.Context(), accessLogContextKey{}, entry)))
+	})
+}
+
+func (l *AccessLogger) requestIDHeader() string {
+	if l.RequestIDHeader != "" {
+		return l.RequestIDHeader
+	}
+	return "X-Request-Id"
+}
+
+// Log writes entry in the format of l.
+func (l *AccessLogger) Log(entry *AccessLogEntry) error {
+	var buf bytes.Buffer
+	switch l.format {
+	case AccessLogCommon, AccessLogCombined:
+		buf.WriteString(orDash(entry.RemoteAddr))
+		buf.WriteString(" - ")
+		buf.WriteString(orDash(entry.User))
+		fmt.Fprintf(&buf, " [%s] %s %d ", entry.CommonTime(), strconv.Quote(entry.RequestLine()), entry.Status)
+		if entry.Bytes > 0 {
+			buf.WriteString(strconv.FormatInt(entry.Bytes, 10))
+		} else {
+			buf.WriteString("-")
+		}
+		if l.format == AccessLogCombined {
+			fmt.Fprintf(&buf, " %s %s", strconv.Quote(orDash(entry.Referer)), strconv.Quote(orDash(entry.UserAgent)))
+		}
+	case AccessLogJSON:
+		err := json.NewEncoder(&buf).Encode(map[string]interface{}{
+			"time":               entry.Time.Format(time.RFC3339Nano),
+			"remote_addr":        entry.RemoteAddr,
+			"user":               entry.User,
+			"method":             entry.Method,
+			"uri":                entry.URI,
+			"proto":              entry.Proto,
+			"status":             entry.Status,
+			"bytes":              entry.Bytes,
+			"uncompressed_bytes": entry.UncompressedBytes,
+			"duration_ms":        float64(entry.Duration) / float64(time.Millisecond),
+			"user_agent":         entry.UserAgent,
+			"referer":            entry.Referer,
+			"request_id":         entry.RequestID,
+		})
+		if err != nil {
+			return err
+		}
+	default:
+		if err := l.template.Execute(&buf, entry); err != nil {
+			return err
+		}
+	}
+	if buf.Len() == 0 || buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	_, err := l.writer.Write(buf.Bytes())
+	return err
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// accessLogEntry returns the entry an AccessLogger records for r, if any.
+func accessLogEntry(r *http.Request) *AccessLogEntry {
+	entry, _ := r.Context().Value(accessLogContextKey{}).(*AccessLogEntry)
+	return entry
+}
+
+// accessLogWriter records the response for the access log. It is
+// http.Flusher and http.Hijacker if the writer it wraps is, but never
+// io.ReaderFrom, as counting the bytes sent requires seeing them. Handlers
+// like http.FileServer therefore copy files through user space instead of
+// using sendfile.
+type accessLogWriter struct {
+	statusWriter
+}
+
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *accessLogWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
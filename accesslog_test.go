@@ -0,0 +1,121 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func serveLogged(t *testing.T, format string, handler http.Handler, r *http.Request) string {
+	var buf bytes.Buffer
+	logger, err := NewAccessLogger(&buf, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Handler(handler).ServeHTTP(httptest.NewRecorder(), r)
+	return buf.String()
+}
+
+func TestAccessLoggerCombined(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+	r := httptest.NewRequest("POST", "/items?x=1", nil)
+	r.SetBasicAuth("anna", "secret")
+	r.Header.Set("Referer", "http://example.com/")
+	r.Header.Set("User-Agent", `test "agent"`)
+
+	line := serveLogged(t, AccessLogCombined, handler, r)
+	expected := regexp.MustCompile(`^192\.0\.2\.1 - anna \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "POST /items\?x=1 HTTP/1\.1" 201 5 "http://example\.com/" "test \\"agent\\""\n$`)
+	if !expected.MatchString(line) {
+		t.Errorf("Unexpected log line %q", line)
+	}
+
+	line = serveLogged(t, AccessLogCommon, http.NotFoundHandler(), httptest.NewRequest("GET", "/", nil))
+	if !strings.HasSuffix(line, `"GET / HTTP/1.1" 404 19`+"\n") {
+		t.Errorf("Unexpected log line %q", line)
+	}
+}
+
+func TestAccessLoggerJSONWithGzip(t *testing.T) {
+	body := strings.Repeat("compressible ", 100)
+	handler := MakeGzipHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "abc")
+		w.Write([]byte(body))
+	})
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+
+	line := serveLogged(t, AccessLogJSON, handler, r)
+	entry := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("Failed to unmarshall json: %v", err)
+	}
+	if entry["uncompressed_bytes"] != float64(len(body)) {
+		t.Errorf("Expected %d uncompressed bytes, but was %v", len(body), entry["uncompressed_bytes"])
+	}
+	if bytes, _ := entry["bytes"].(float64); bytes <= 0 || bytes >= float64(len(body)) {
+		t.Errorf("Expected fewer compressed bytes, but was %v", entry["bytes"])
+	}
+	if entry["request_id"] != "abc" || entry["status"] != float64(http.StatusOK) {
+		t.Errorf("Unexpected entry %v", entry)
+	}
+}
+
+func TestAccessLoggerEmptyHandler(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	line := serveLogged(t, AccessLogCommon, handler, httptest.NewRequest("GET", "/x", nil))
+	if !strings.HasSuffix(line, `"GET /x HTTP/1.1" 200 -`+"\n") {
+		t.Errorf("Expected empty response to be logged with status 200, but was %q", line)
+	}
+}
+
+func TestAccessLoggerTemplate(t *testing.T) {
+	line := serveLogged(t, "{{.Method}} {{.URI}} {{.Status}}", http.NotFoundHandler(), httptest.NewRequest("GET", "/missing", nil))
+	if line != "GET /missing 404\n" {
+		t.Errorf("Unexpected log line %q", line)
+	}
+
+	if _, err := NewAccessLogger(nil, "{{.Method"); err == nil {
+		t.Error("Expected invalid template to be rejected")
+	}
+}
+
+func TestAccessLoggerPreservesInterfaces(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := NewAccessLogger(&buf, AccessLogCommon)
+	r := httptest.NewRequest("GET", "/", nil)
+
+	logger.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("Expected http.Flusher to be preserved")
+		}
+		if _, ok := w.(http.Hijacker); ok {
+			t.Error("Expected http.Hijacker not to be advertised")
+		}
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Expected flushing through Unwrap to work, but got %v", err)
+		}
+	})).ServeHTTP(httptest.NewRecorder(), r)
+
+	hw := &hijackableRecorder{ResponseRecorder: httptest.NewRecorder()}
+	logger.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Fatalf("Expected hijacking to work, but got %v", err)
+		}
+		conn.Close()
+	})).ServeHTTP(hw, r)
+	if !hw.hijacked || !strings.Contains(buf.String(), `"GET / HTTP/1.1" 101 -`) {
+		t.Errorf("Expected hijacked connection to be logged, but was %q", buf.String())
+	}
+}
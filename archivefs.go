@@ -0,0 +1,481 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"hash/adler32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArchiveFileSystem is a read-only http.FileSystem serving the contents
+// of a zip or tar archive.
+//
+// Directories which are not stored in the archive explicitly are derived
+// from the paths of the files within them. Their modification time is
+// the latest one of their contents.
+type ArchiveFileSystem struct {
+	nodes  map[string]*archiveNode
+	closer io.Closer
+}
+
+type archiveNode struct {
+	info     os.FileInfo
+	children []*archiveNode
+	open     func() (io.ReadSeeker, error)
+	encoded  func(encoding string) io.ReadSeeker
+}
+
+// OpenArchiveFileSystem opens the zip or tar archive with the given file
+// name. The archive type is determined from the file name extension,
+// tar archives may be gzip compressed.
+//
+// Call Close to release the file once the file system is no longer used.
+func OpenArchiveFileSystem(name string) (*ArchiveFileSystem, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip") || strings.HasSuffix(lower, ".jar"):
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		a, err := NewZipFileSystem(f, fi.Size())
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		a.closer = f
+		return a, nil
+	case strings.HasSuffix(lower, ".tar") || strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz"):
+		defer f.Close()
+		return NewTarFileSystem(f)
+	}
+	f.Close()
+	return nil, errors.New("unsupported archive type: " + name)
+}
+
+// NewZipFileSystem returns an ArchiveFileSystem serving the zip archive
+// read from r, which must remain readable while the file system is used.
+//
+// Files are read from r on demand. Deflate compressed files are sent
+// without recompression by ServeFile to clients accepting the gzip or
+// deflate content codings.
+func NewZipFileSystem(r io.ReaderAt, size int64) (*ArchiveFileSystem, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	a := newArchiveFileSystem()
+	for _, file := range zr.File {
+		name := path.Clean("/" + file.Name)
+		info := file.FileInfo()
+		if info.IsDir() {
+			a.addDir(name, info)
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		offset, err := file.DataOffset()
+		if err != nil {
+			return nil, err
+		}
+		node := &archiveNode{info: info}
+		switch file.Method {
+		case zip.Store:
+			section := io.NewSectionReader(r, offset, int64(file.UncompressedSize64))
+			node.open = func() (io.ReadSeeker, error) {
+				return io.NewSectionReader(section, 0, section.Size()), nil
+			}
+		case zip.Deflate:
+			node.open = inflatingOpener(file)
+			node.encoded = deflatedContent(file, io.NewSectionReader(r, offset, int64(file.CompressedSize64)))
+		default:
+			node.open = inflatingOpener(file)
+		}
+		a.add(name, node)
+	}
+	a.sort()
+	return a, nil
+}
+
+// NewTarFileSystem returns an ArchiveFileSystem serving the optionally
+// gzip compressed tar archive read from r. All files are kept in memory.
+func NewTarFileSystem(r io.Reader) (*ArchiveFileSystem, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+
+	a := newArchiveFileSystem()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean("/" + hdr.Name)
+		info := hdr.FileInfo()
+		switch {
+		case info.IsDir():
+			a.addDir(name, info)
+		case info.Mode().IsRegular():
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			a.add(name, &archiveNode{
+				info: info,
+				open: func() (io.ReadSeeker, error) {
+					return bytes.NewReader(data), nil
+				},
+			})
+		}
+	}
+	a.sort()
+	return a, nil
+}
+
+func newArchiveFileSystem() *ArchiveFileSystem {
+	a := &ArchiveFileSystem{nodes: make(map[string]*archiveNode)}
+	a.dir("/", time.Time{})
+	return a
+}
+
+// Open implements http.FileSystem.
+func (a *ArchiveFileSystem) Open(name string) (http.File, error) {
+	node, ok := a.nodes[path.Clean("/"+name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if node.info.IsDir() {
+		return &archiveDir{node: node}, nil
+	}
+	content, err := node.open()
+	if err != nil {
+		return nil, err
+	}
+	return &archiveFile{ReadSeeker: content, node: node}, nil
+}
+
+// Close releases the archive file opened by OpenArchiveFileSystem.
+func (a *ArchiveFileSystem) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+func (a *ArchiveFileSystem) add(name string, node *archiveNode) {
+	if existing, ok := a.nodes[name]; ok {
+		if !existing.info.IsDir() {
+			// Like when extracting, later entries replace earlier ones.
+			*existing = *node
+		}
+		return
+	}
+	a.nodes[name] = node
+	parent := a.dir(path.Dir(name), node.info.ModTime())
+	parent.children = append(parent.children, node)
+}
+
+func (a *ArchiveFileSystem) addDir(name string, info os.FileInfo) {
+	node := a.dir(name, info.ModTime())
+	node.info = info
+}
+
+// dir returns the directory node with the given name, creating it and its
+// parents as needed, and updates the modification time of derived ones.
+func (a *ArchiveFileSystem) dir(name string, modTime time.Time) *archiveNode {
+	node, ok := a.nodes[name]
+	if !ok {
+		node = &archiveNode{info: &archiveDirInfo{name: path.Base(name)}}
+		a.nodes[name] = node
+		if name != "/" {
+			parent := a.dir(path.Dir(name), modTime)
+			parent.children = append(parent.children, node)
+		}
+	} else if name != "/" {
+		a.dir(path.Dir(name), modTime)
+	}
+	if info, ok := node.info.(*archiveDirInfo); ok && modTime.After(info.modTime) {
+		info.modTime = modTime
+	}
+	return node
+}
+
+func (a *ArchiveFileSystem) sort() {
+	for _, node := range a.nodes {
+		sort.Sort(archiveNodesByName(node.children))
+	}
+}
+
+type archiveNodesByName []*archiveNode
+
+func (s archiveNodesByName) Len() int           { return len(s) }
+func (s archiveNodesByName) Less(i, j int) bool { return s[i].info.Name() < s[j].info.Name() }
+func (s archiveNodesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type archiveDirInfo struct {
+	name    string
+	modTime time.Time
+}
+
+func (fi *archiveDirInfo) Name() string       { return fi.name }
+func (fi *archiveDirInfo) Size() int64        { return 0 }
+func (fi *archiveDirInfo) Mode() os.FileMode  { return os.ModeDir | 0555 }
+func (fi *archiveDirInfo) ModTime() time.Time { return fi.modTime }
+func (fi *archiveDirInfo) IsDir() bool        { return true }
+func (fi *archiveDirInfo) Sys() interface{}   { return nil }
+
+type archiveFile struct {
+	io.ReadSeeker
+	node *archiveNode
+}
+
+func (f *archiveFile) Close() error {
+	if closer, ok := f.ReadSeeker.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (f *archiveFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, errors.New("not a directory")
+}
+
+func (f *archiveFile) Stat() (os.FileInfo, error) {
+	return f.node.info, nil
+}
+
+func (f *archiveFile) encodedContent(encoding string) io.ReadSeeker {
+	if f.node.encoded == nil {
+		return nil
+	}
+	return f.node.encoded(encoding)
+}
+
+type archiveDir struct {
+	node   *archiveNode
+	offset int
+}
+
+func (d *archiveDir) Close() error {
+	return nil
+}
+
+func (d *archiveDir) Read(p []byte) (int, error) {
+	return 0, errors.New("is a directory")
+}
+
+func (d *archiveDir) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		d.offset = 0
+		return 0, nil
+	}
+	return 0, errors.New("is a directory")
+}
+
+func (d *archiveDir) Readdir(count int) ([]os.FileInfo, error) {
+	remaining := d.node.children[d.offset:]
+	if count > 0 && len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count <= 0 || count > len(remaining) {
+		count = len(remaining)
+	}
+	infos := make([]os.FileInfo, count)
+	for i, child := range remaining[:count] {
+		infos[i] = child.info
+	}
+	d.offset += count
+	return infos, nil
+}
+
+func (d *archiveDir) Stat() (os.FileInfo, error) {
+	return d.node.info, nil
+}
+
+func inflatingOpener(file *zip.File) func() (io.ReadSeeker, error) {
+	return func() (io.ReadSeeker, error) {
+		return &inflatingReader{file: file, size: int64(file.UncompressedSize64)}, nil
+	}
+}
+
+// inflatingReader provides seeking within a compressed zip entry by
+// decompressing it from the start whenever it needs to go backwards.
+type inflatingReader struct {
+	file   *zip.File
+	rc     io.ReadCloser
+	pos    int64
+	offset int64
+	size   int64
+}
+
+func (r *inflatingReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.rc == nil || r.pos > r.offset {
+		r.Close()
+		rc, err := r.file.Open()
+		if err != nil {
+			return 0, err
+		}
+		r.rc, r.pos = rc, 0
+	}
+	if r.pos < r.offset {
+		n, err := io.CopyN(ioutil.Discard, r.rc, r.offset-r.pos)
+		r.pos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.rc.Read(p)
+	r.pos += int64(n)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *inflatingReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *inflatingReader) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc = nil
+	return err
+}
+
+// deflatedContent wraps the raw deflate stream of a zip entry into the
+// gzip and zlib formats, which is possible without recompression since
+// only headers and checksums need to be added.
+func deflatedContent(file *zip.File, raw *io.SectionReader) func(encoding string) io.ReadSeeker {
+	var once sync.Once
+	var adler uint32
+	var adlerErr error
+	return func(encoding string) io.ReadSeeker {
+		var header, trailer []byte
+		switch encoding {
+		case "gzip":
+			header = []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 0xff}
+			binary.LittleEndian.PutUint32(header[4:8], uint32(file.Modified.Unix()))
+			trailer = make([]byte, 8)
+			binary.LittleEndian.PutUint32(trailer[0:4], file.CRC32)
+			binary.LittleEndian.PutUint32(trailer[4:8], uint32(file.UncompressedSize64))
+		case "deflate":
+			// Unlike gzip, zlib wants an Adler-32 checksum, which the
+			// zip format does not store.
+			once.Do(func() {
+				var rc io.ReadCloser
+				if rc, adlerErr = file.Open(); adlerErr == nil {
+					h := adler32.New()
+					_, adlerErr = io.Copy(h, rc)
+					rc.Close()
+					adler = h.Sum32()
+				}
+			})
+			if adlerErr != nil {
+				return nil
+			}
+			header = []byte{0x78, 0x9c}
+			trailer = make([]byte, 4)
+			binary.BigEndian.PutUint32(trailer, adler)
+		default:
+			return nil
+		}
+		parts := multiReaderAt{bytes.NewReader(header), raw, bytes.NewReader(trailer)}
+		return io.NewSectionReader(parts, 0, parts.Size())
+	}
+}
+
+type sizedReaderAt interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// multiReaderAt is the logical concatenation of its parts.
+type multiReaderAt []sizedReaderAt
+
+func (m multiReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for _, part := range m {
+		if n == len(p) {
+			break
+		}
+		size := part.Size()
+		if off >= size {
+			off -= size
+			continue
+		}
+		want := len(p) - n
+		if int64(want) > size-off {
+			want = int(size - off)
+		}
+		k, err := part.ReadAt(p[n:n+want], off)
+		n += k
+		if k < want {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+		off = 0
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m multiReaderAt) Size() int64 {
+	var size int64
+	for _, part := range m {
+		size += part.Size()
+	}
+	return size
+}
@@ -0,0 +1,127 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var archiveTestModTime = time.Date(2014, 6, 1, 12, 0, 0, 0, time.UTC)
+
+var archiveTestFiles = map[string]string{
+	"index.html":    "<html>" + strings.Repeat("Hello, World! ", 100) + "</html>",
+	"js/app.js":     strings.Repeat("console.log('app');\n", 50),
+	"img/blank.gif": "GIF89a\x01\x00\x01\x00\x80\x00\x00",
+}
+
+func makeTestZip(t *testing.T) *ArchiveFileSystem {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range archiveTestFiles {
+		method := zip.Deflate
+		if strings.HasSuffix(name, ".gif") {
+			method = zip.Store
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: archiveTestModTime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := NewZipFileSystem(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func makeTestTarGz(t *testing.T) *ArchiveFileSystem {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for name, content := range archiveTestFiles {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: archiveTestModTime, Typeflag: tar.TypeReg})
+		io.WriteString(tw, content)
+	}
+	tw.Close()
+	zw.Close()
+	fs, err := NewTarFileSystem(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestArchiveFileSystem_ServeFile(t *testing.T) {
+	for kind, fs := range map[string]*ArchiveFileSystem{"zip": makeTestZip(t), "tar": makeTestTarGz(t)} {
+		for name, content := range archiveTestFiles {
+			r, _ := http.NewRequest("GET", "/"+name, nil)
+			r.Header.Set("Range", "bytes=3-9")
+			w := httptest.NewRecorder()
+			ServeFile(w, r, fs, "/"+name)
+			if w.Code != http.StatusPartialContent || w.Body.String() != content[3:10] {
+				t.Errorf("%s: expected range of %s to be '%s', but was '%s' (%d)", kind, name, content[3:10], w.Body.String(), w.Code)
+			}
+			if modified := w.Header().Get("Last-Modified"); modified != archiveTestModTime.Format(http.TimeFormat) {
+				t.Errorf("%s: unexpected modification time %s of %s", kind, modified, name)
+			}
+		}
+
+		d, err := fs.Open("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		infos, _ := d.Readdir(-1)
+		if len(infos) != 3 || infos[0].Name() != "img" || !infos[0].IsDir() || !infos[0].ModTime().Equal(archiveTestModTime) {
+			t.Errorf("%s: unexpected root directory listing %v", kind, infos)
+		}
+	}
+}
+
+func TestArchiveFileSystem_ServesDeflatedEntriesWithoutRecompression(t *testing.T) {
+	fs := makeTestZip(t)
+	for encoding, decode := range map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+		"deflate": func(r io.Reader) (io.Reader, error) {
+			return zlib.NewReader(r)
+		},
+	} {
+		r, _ := http.NewRequest("GET", "/js/app.js", nil)
+		r.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+		FileStaticServer(fs).ServeHTTP(w, r)
+		if actual := w.Header().Get("Content-Encoding"); actual != encoding {
+			t.Errorf("Expected content encoding %s, but was '%s'", encoding, actual)
+			continue
+		}
+		zr, err := decode(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Errorf("%s: failed to decode response: %v", encoding, err)
+		}
+		if string(data) != archiveTestFiles["js/app.js"] {
+			t.Errorf("%s: decoded response does not match", encoding)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// CachedFileSystem is an http.FileSystem which keeps the contents and
+// os.FileInfo of small files from another http.FileSystem in memory.
+//
+// Once the cached data exceeds MaxSize, entries are evicted in least
+// recently used order. Directories and files larger than MaxFileSize are
+// always opened from the underlying file system.
+//
+// The exported fields must not be changed once the file system is in use.
+type CachedFileSystem struct {
+	// MaxSize is the maximum number of bytes kept in memory, including
+	// precompressed content.
+	MaxSize int64
+
+	// MaxFileSize is the maximum size of a file to be cached.
+	MaxFileSize int64
+
+	// ValidateInterval controls how often a cached entry is checked
+	// against the modification time and size of the underlying file,
+	// DefaultValidateInterval for file systems returned by
+	// NewCachedFileSystem. When zero, this happens on every Open. When
+	// negative, entries are only dropped by Invalidate, Purge or eviction.
+	ValidateInterval time.Duration
+
+	// Gzip enables keeping a gzip compressed copy of cached files,
+	// which ServeFile sends to clients accepting it.
+	Gzip bool
+
+	// ETag enables strong ETags computed from the contents of cached
+	// files, which ServeFile sets on its responses.
+	ETag bool
+
+	fs       http.FileSystem
+	mutex    sync.Mutex
+	size     int64
+	entries  map[string]*list.Element
+	lru      *list.List
+	hits     uint64
+	misses   uint64
+	bypassed uint64
+}
+
+// CacheStats holds the counters of a CachedFileSystem. Misses counts
+// lookups of cacheable files only, opens of directories and files larger
+// than MaxFileSize are counted as Bypassed.
+type CacheStats struct {
+	Hits     uint64
+	Misses   uint64
+	Bypassed uint64
+	Entries  int
+	Size     int64
+}
+
+type cacheEntry struct {
+	name    string
+	info    os.FileInfo
+	data    []byte
+	gzipped []byte
+	etag    string
+	checked time.Time
+}
+
+func (e *cacheEntry) size() int64 {
+	return int64(len(e.data) + len(e.gzipped))
+}
+
+// DefaultValidateInterval is the ValidateInterval of file systems returned
+// by NewCachedFileSystem.
+const DefaultValidateInterval = 2 * time.Second
+
+// NewCachedFileSystem returns a CachedFileSystem caching up to maxSize
+// bytes of files from fs. MaxFileSize defaults to 1 MiB or maxSize,
+// whichever is smaller.
+func NewCachedFileSystem(fs http.FileSystem, maxSize int64) *CachedFileSystem {
+	maxFileSize := int64(1 << 20)
+	if maxSize < maxFileSize {
+		maxFileSize = maxSize
+	}
+	return &CachedFileSystem{
+		MaxSize:          maxSize,
+		MaxFileSize:      maxFileSize,
+		ValidateInterval: DefaultValidateInterval,
+		fs:               fs,
+		entries:          make(map[string]*list.Element),
+		lru:              list.New(),
+	}
+}
+
+// Open implements http.FileSystem.
+func (c *CachedFileSystem) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+	entry, validate := c.get(name)
+	if entry == nil {
+		f, err := c.fs.Open(name)
+		if err != nil {
+			c.count(&c.misses)
+			return nil, err
+		}
+		return c.load(name, f)
+	}
+	if validate {
+		f, err := c.fs.Open(name)
+		if err != nil {
+			c.Invalidate(name)
+			c.count(&c.misses)
+			return nil, err
+		}
+		if fi, err := f.Stat(); err != nil || fi.Size() != entry.info.Size() || !fi.ModTime().Equal(entry.info.ModTime()) {
+			c.Invalidate(name)
+			return c.load(name, f)
+		}
+		f.Close()
+		c.mutex.Lock()
+		entry.checked = time.Now()
+		c.mutex.Unlock()
+	}
+	c.count(&c.hits)
+	return &cachedFile{bytes.NewReader(entry.data), entry}, nil
+}
+
+// Invalidate removes the file with the given name from the cache.
+func (c *CachedFileSystem) Invalidate(name string) {
+	name = path.Clean("/" + name)
+	c.mutex.Lock()
+	if element, ok := c.entries[name]; ok {
+		c.remove(element)
+	}
+	c.mutex.Unlock()
+}
+
+// Purge removes all files from the cache.
+func (c *CachedFileSystem) Purge() {
+	c.mutex.Lock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+	c.mutex.Unlock()
+}
+
+// Stats returns the current cache counters.
+func (c *CachedFileSystem) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return CacheStats{
+		Hits:     c.hits,
+		Misses:   c.misses,
+		Bypassed: c.bypassed,
+		Entries:  len(c.entries),
+		Size:     c.size,
+	}
+}
+
+func (c *CachedFileSystem) get(name string) (entry *cacheEntry, validate bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[name]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	entry = element.Value.(*cacheEntry)
+	validate = c.ValidateInterval >= 0 && time.Since(entry.checked) >= c.ValidateInterval
+	return entry, validate
+}
+
+func (c *CachedFileSystem) count(counter *uint64) {
+	c.mutex.Lock()
+	*counter++
+	c.mutex.Unlock()
+}
+
+// load reads f into the cache if it is suitable, otherwise f is returned
+// as is.
+func (c *CachedFileSystem) load(name string, f http.File) (http.File, error) {
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() || fi.Size() > c.MaxFileSize {
+		c.count(&c.bypassed)
+		return f, nil
+	}
+	defer f.Close()
+	c.count(&c.misses)
+
+	data, err := ioutil.ReadAll(io.LimitReader(f, c.MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	entry := &cacheEntry{
+		name:    name,
+		info:    fi,
+		data:    data,
+		checked: time.Now(),
+	}
+	if int64(len(data)) != fi.Size() {
+		// Changed while reading, serve it but don't keep it.
+		return &cachedFile{bytes.NewReader(data), entry}, nil
+	}
+	if c.ETag {
+		entry.etag = contentETag(data)
+	}
+	if c.Gzip {
+		entry.gzipped = gzipBytes(data)
+	}
+
+	c.mutex.Lock()
+	if element, ok := c.entries[name]; ok {
+		c.remove(element)
+	}
+	if entry.size() <= c.MaxSize {
+		c.entries[name] = c.lru.PushFront(entry)
+		c.size += entry.size()
+		for c.size > c.MaxSize {
+			c.remove(c.lru.Back())
+		}
+	}
+	c.mutex.Unlock()
+
+	return &cachedFile{bytes.NewReader(data), entry}, nil
+}
+
+func (c *CachedFileSystem) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*cacheEntry)
+	delete(c.entries, entry.name)
+	c.size -= entry.size()
+}
+
+// gzipBytes returns the gzip compressed data, or nil if compression
+// doesn't save anything worthwhile.
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	w.Write(data)
+	w.Close()
+	if buf.Len() >= len(data)-len(data)/10 {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+type cachedFile struct {
+	*bytes.Reader
+	entry *cacheEntry
+}
+
+func (f *cachedFile) Close() error {
+	return nil
+}
+
+func (f *cachedFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, errors.New("not a directory")
+}
+
+func (f *cachedFile) Stat() (os.FileInfo, error) {
+	return f.entry.info, nil
+}
+
+func (f *cachedFile) etag() string {
+	return f.entry.etag
+}
+
+func (f *cachedFile) encodedContent(encoding string) io.ReadSeeker {
+	if encoding == "gzip" && f.entry.gzipped != nil {
+		return bytes.NewReader(f.entry.gzipped)
+	}
+	return nil
+}
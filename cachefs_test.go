@@ -0,0 +1,155 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type countingFileSystem struct {
+	http.FileSystem
+	opened *int
+}
+
+func (fs countingFileSystem) Open(name string) (http.File, error) {
+	*fs.opened++
+	return fs.FileSystem.Open(name)
+}
+
+func TestCachedFileSystem_HitsAndInvalidation(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.js")
+	if err := ioutil.WriteFile(name, []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opened := 0
+	fs := NewCachedFileSystem(countingFileSystem{http.Dir(dir), &opened}, 1024)
+
+	read := func() string {
+		f, err := fs.Open("/app.js")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		data, _ := ioutil.ReadAll(f)
+		return string(data)
+	}
+
+	read()
+	if content := read(); content != "one" {
+		t.Errorf("Expected cached content 'one', but was '%s'", content)
+	}
+	if stats := fs.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 || stats.Size != 3 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if opened != 1 {
+		t.Errorf("Expected cached file not to be validated within interval, but opened %d times", opened)
+	}
+
+	fs.ValidateInterval = 0
+
+	ioutil.WriteFile(name, []byte("two!"), 0644)
+	os.Chtimes(name, time.Now(), time.Now().Add(time.Hour))
+	if content := read(); content != "two!" {
+		t.Errorf("Expected changed file to be reloaded, but was '%s'", content)
+	}
+
+	fs.ValidateInterval = -1
+	ioutil.WriteFile(name, []byte("three"), 0644)
+	if content := read(); content != "two!" {
+		t.Errorf("Expected file not to be validated, but was '%s'", content)
+	}
+	fs.Invalidate("app.js")
+	if content := read(); content != "three" {
+		t.Errorf("Expected invalidated file to be reloaded, but was '%s'", content)
+	}
+}
+
+func TestCachedFileSystem_Eviction(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		ioutil.WriteFile(filepath.Join(dir, name), bytes.Repeat([]byte(name), 4), 0644)
+	}
+	fs := NewCachedFileSystem(http.Dir(dir), 10)
+	for _, name := range []string{"a", "b", "a", "c"} {
+		f, err := fs.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	if stats := fs.Stats(); stats.Entries != 2 || stats.Size != 8 {
+		t.Errorf("Unexpected stats after eviction %+v", stats)
+	}
+	fs.Open("a")
+	if stats := fs.Stats(); stats.Hits != 2 {
+		t.Errorf("Expected most recently used file to be kept, stats %+v", stats)
+	}
+}
+
+func TestCachedFileSystem_ServesPrecompressedContent(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Repeat("body { color: red; }\n", 100)
+	ioutil.WriteFile(filepath.Join(dir, "style.css"), []byte(content), 0644)
+	fs := NewCachedFileSystem(http.Dir(dir), 1<<20)
+	fs.Gzip = true
+	fs.ETag = true
+
+	r, _ := http.NewRequest("GET", "/style.css", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	FileStaticServer(fs).ServeHTTP(w, r)
+
+	if encoding := w.Header().Get("Content-Encoding"); encoding != "gzip" {
+		t.Fatalf("Expected gzip encoding, but was '%s'", encoding)
+	}
+	if ctype := w.Header().Get("Content-Type"); !strings.HasPrefix(ctype, "text/css") {
+		t.Errorf("Expected text/css content type, but was '%s'", ctype)
+	}
+	etag := w.Header().Get("ETag")
+	if !strings.HasSuffix(etag, "-gzip\"") {
+		t.Errorf("Expected ETag of gzip representation, but was '%s'", etag)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(zr); string(data) != content {
+		t.Error("Decompressed response does not match file content")
+	}
+
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	FileStaticServer(fs).ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected conditional request to return %d, but was %d", http.StatusNotModified, w.Code)
+	}
+}
+
+func TestCachedFileSystem_CountsUncacheableOpensAsBypassed(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "large"), bytes.Repeat([]byte("x"), 20), 0644)
+	fs := NewCachedFileSystem(http.Dir(dir), 10)
+	for _, name := range []string{"/", "sub", "large", "large"} {
+		f, err := fs.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	if stats := fs.Stats(); stats.Hits != 0 || stats.Misses != 0 || stats.Bypassed != 4 || stats.Entries != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
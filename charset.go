@@ -0,0 +1,244 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// charsetEncoder maps a rune to its single byte representation.
+type charsetEncoder func(r rune) (byte, bool)
+
+func encodeLatin1(r rune) (byte, bool) {
+	return byte(r), r < 0x100
+}
+
+func encodeASCII(r rune) (byte, bool) {
+	return byte(r), r < 0x80
+}
+
+var latin9Replacements = map[rune]byte{
+	'€': 0xa4, 'Š': 0xa6, 'š': 0xa8, 'Ž': 0xb4, 'ž': 0xb8, 'Œ': 0xbc, 'œ': 0xbd, 'Ÿ': 0xbe,
+}
+
+func encodeLatin9(r rune) (byte, bool) {
+	if b, ok := latin9Replacements[r]; ok {
+		return b, true
+	}
+	switch r {
+	case 0xa4, 0xa6, 0xa8, 0xb4, 0xb8, 0xbc, 0xbd, 0xbe:
+		return 0, false
+	}
+	return encodeLatin1(r)
+}
+
+var windows1252Replacements = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+func encodeWindows1252(r rune) (byte, bool) {
+	if b, ok := windows1252Replacements[r]; ok {
+		return b, true
+	}
+	if r >= 0x80 && r < 0xa0 {
+		return 0, false
+	}
+	return encodeLatin1(r)
+}
+
+// charsetEncoders holds the charsets MakeCharsetHandler transcodes to.
+var charsetEncoders = map[string]charsetEncoder{
+	"iso-8859-1":   encodeLatin1,
+	"iso-8859-15":  encodeLatin9,
+	"us-ascii":     encodeASCII,
+	"windows-1252": encodeWindows1252,
+}
+
+// NegotiateCharset returns the charset out of offered which suits r best
+// according to its Accept-Charset header. Charsets are compared case
+// insensitively, ties are resolved in favour of the offer listed first and
+// charsets refused with q=0 are never returned.
+//
+// If r has no Accept-Charset header, the first offer is returned. The
+// second return value is false if none of the offers is acceptable.
+func NegotiateCharset(r *http.Request, offered ...string) (string, bool) {
+	header := strings.TrimSpace(r.Header.Get("Accept-Charset"))
+	if header == "" {
+		if len(offered) == 0 {
+			return "", false
+		}
+		return offered[0], true
+	}
+
+	qualities := make(map[string]float64)
+	for _, raw := range strings.Split(header, ",") {
+		parts := strings.Split(raw, ";")
+		charset := strings.ToLower(strings.TrimSpace(parts[0]))
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				var err error
+				if q, err = strconv.ParseFloat(param[2:], 64); err != nil {
+					q = 0
+				}
+			}
+		}
+		if charset != "" {
+			qualities[charset] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offered {
+		q, ok := qualities[strings.ToLower(offer)]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// MakeCharsetHandler wraps handler such that its text/* responses are
+// transcoded from UTF-8 to the charset preferred by the client according
+// to the Accept-Charset header, adding the charset parameter to the
+// Content-Type. Supported are ISO-8859-1, ISO-8859-15, US-ASCII and
+// Windows-1252. Characters without representation in the target charset
+// are replaced by character references in HTML and XML, and by "?"
+// otherwise.
+//
+// Responses in other charsets, of other types or with a Content-Encoding
+// are passed through unchanged. When combined with MakeGzipHandler, the
+// latter has to be the outer one.
+func MakeCharsetHandler(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		addVary(w.Header(), "Accept-Charset")
+		charset, _ := NegotiateCharset(r, "utf-8", "iso-8859-1", "windows-1252", "iso-8859-15", "us-ascii")
+		if charset == "utf-8" || charset == "" {
+			handler(w, r)
+			return
+		}
+		tw := &transcodingResponseWriter{
+			ResponseWriter: w,
+			charset:        charset,
+			encoder:        charsetEncoders[charset],
+		}
+		defer tw.close()
+		handler(exposeOptionalInterfaces(tw), r)
+	}
+}
+
+// transcodingResponseWriter transcodes text written to it. It is
+// http.Flusher and http.Hijacker if the writer it wraps is, but never
+// io.ReaderFrom, as transcoding requires seeing the bytes written.
+type transcodingResponseWriter struct {
+	http.ResponseWriter
+	charset     string
+	encoder     charsetEncoder
+	references  bool
+	wroteHeader bool
+	transcode   bool
+	hijacked    bool
+	pending     []byte
+}
+
+func (w *transcodingResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	mediaType := ParseMediaType(h.Get("Content-Type"))
+	if mediaType.Type == "text" && h.Get("Content-Encoding") == "" &&
+		(mediaType.Charset() == "" || mediaType.Charset() == "utf-8") {
+		w.transcode = true
+		w.references = mediaType.SubType == "html" || mediaType.SubType == "xml"
+		if mediaType.Params == nil {
+			mediaType.Params = make(map[string]string)
+		}
+		mediaType.Params["charset"] = w.charset
+		h.Set("Content-Type", mediaType.String())
+		h.Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *transcodingResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.transcode {
+		return w.ResponseWriter.Write(b)
+	}
+
+	data := b
+	if len(w.pending) > 0 {
+		data = append(w.pending, b...)
+		w.pending = nil
+	}
+	out := make([]byte, 0, len(data))
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 && !utf8.FullRune(data) {
+			// Incomplete sequence, wait for the next write.
+			w.pending = append([]byte(nil), data...)
+			break
+		}
+		out = w.encode(out, r)
+		data = data[size:]
+	}
+	if _, err := w.ResponseWriter.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (w *transcodingResponseWriter) encode(out []byte, r rune) []byte {
+	if c, ok := w.encoder(r); ok {
+		return append(out, c)
+	}
+	if w.references && r != utf8.RuneError {
+		return append(out, fmt.Sprintf("&#%d;", r)...)
+	}
+	return append(out, '?')
+}
+
+func (w *transcodingResponseWriter) close() {
+	if len(w.pending) > 0 && !w.hijacked {
+		w.ResponseWriter.Write([]byte{'?'})
+	}
+}
+
+func (w *transcodingResponseWriter) Flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *transcodingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+func (w *transcodingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,106 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateCharset(t *testing.T) {
+	for acceptCharset, expected := range map[string]string{
+		"":                             "utf-8",
+		"ISO-8859-1":                   "iso-8859-1",
+		"iso-8859-1, utf-8;q=0.5":      "iso-8859-1",
+		"iso-8859-1;q=0.5, *":          "utf-8",
+		"*, utf-8;q=0":                 "iso-8859-1",
+		"windows-1252, iso-8859-1":     "iso-8859-1",
+		"windows-1252;q=0.9, koi8-r":   "windows-1252",
+		"iso-8859-1;q=0.5, utf-8;q=.5": "utf-8",
+	} {
+		r, _ := http.NewRequest("", "", nil)
+		if acceptCharset != "" {
+			r.Header.Set("Accept-Charset", acceptCharset)
+		}
+		if actual, _ := NegotiateCharset(r, "utf-8", "iso-8859-1", "windows-1252"); actual != expected {
+			t.Errorf("Expected %s for '%s', but was %s", expected, acceptCharset, actual)
+		}
+	}
+}
+
+func TestMakeCharsetHandler(t *testing.T) {
+	for _, test := range []struct {
+		contentType, body, acceptCharset, expectedType, expectedBody string
+	}{
+		{"text/plain; charset=utf-8", "Grüße ¤ ☃", "iso-8859-1", "text/plain; charset=iso-8859-1", "Gr\xfc\xdfe \xa4 ?"},
+		{"text/plain", "Grüße € ☃", "windows-1252", "text/plain; charset=windows-1252", "Gr\xfc\xdfe \x80 ?"},
+		{"text/html", "Grüße € ☃", "iso-8859-15", "text/html; charset=iso-8859-15", "Gr\xfc\xdfe \xa4 &#9731;"},
+		{"text/plain", "Grüße € ☃", "", "text/plain", "Grüße € ☃"},
+		{"application/json", "Grüße € ☃", "iso-8859-1", "application/json", "Grüße € ☃"},
+	} {
+		handler := MakeCharsetHandler(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", test.contentType)
+			// Split the multibyte sequence of ü across writes.
+			w.Write([]byte(test.body[:3]))
+			w.Write([]byte(test.body[3:]))
+		})
+		r, _ := http.NewRequest("GET", "/", nil)
+		if test.acceptCharset != "" {
+			r.Header.Set("Accept-Charset", test.acceptCharset)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if contentType := w.Header().Get("Content-Type"); contentType != test.expectedType {
+			t.Errorf("Expected Content-Type %s, but was %s", test.expectedType, contentType)
+		}
+		if body := w.Body.String(); body != test.expectedBody {
+			t.Errorf("Expected body %q for %s, but was %q", test.expectedBody, test.acceptCharset, body)
+		}
+	}
+}
+
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (w *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	conn, _ := net.Pipe()
+	return conn, bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)), nil
+}
+
+func TestMakeCharsetHandler_Hijack(t *testing.T) {
+	handler := MakeCharsetHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("caf\xc3"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Expected flushing through Unwrap to work, but got %v", err)
+		}
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			t.Fatal("Expected http.Hijacker to be preserved")
+		}
+		conn, _, _ := hijacker.Hijack()
+		conn.Close()
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Charset", "iso-8859-1")
+	w := &hijackableRecorder{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(w, r)
+	if !w.hijacked || w.Body.String() != "caf" {
+		t.Errorf("Expected pending bytes to be dropped after hijacking, but body was %q", w.Body.String())
+	}
+
+	handler = MakeCharsetHandler(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Hijacker); ok {
+			t.Error("Expected http.Hijacker not to be advertised")
+		}
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+}
@@ -6,6 +6,8 @@ package httputils
 
 import (
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -13,70 +15,282 @@ import (
 // response to r, otherwise false.
 //
 // As such, it is only suitable for endpoints which serve a fixed content type.
+// Use Negotiate for endpoints capable of serving several content types.
 func AcceptsContentType(r *http.Request, contentType string) bool {
-	values, ok := r.Header[http.CanonicalHeaderKey("Accept")]
-	if !ok || values[0] == "" {
+	_, ok := Negotiate(r, contentType)
+	return ok
+}
+
+// ContainsContentType returns true if the requests content type matches
+// contentType, otherwise false.
+//
+// Note that contentType may be a wildcard. Matching follows the rules of
+// MediaType.Matches, so "application/json" also matches structured syntax
+// types like "application/merge-patch+json", and parameters such as
+// "charset=utf-8" or "version=2" of contentType must be present in the
+// request.
+func ContainsContentType(r *http.Request, contentType string) bool {
+	target := ParseMediaType(contentType)
+	header := r.Header.Get("Content-Type")
+	return target.Matches(ParseMediaType(header))
+}
+
+// Negotiate returns the media type out of offered which is the best
+// response to r according to its Accept header, following the rules of
+// RFC 7231 section 5.3.2. The q-value of the most specific media range
+// matching an offer applies, ties are resolved in favour of the offer
+// listed first. Offers which are not acceptable at all, for example due
+// to q=0, are never returned. A charset parameter of a media range only
+// excludes offers naming a different charset.
+//
+// If r has no Accept header, the first offer is returned. The second
+// return value is false if none of the offers is acceptable.
+func Negotiate(r *http.Request, offered ...string) (string, bool) {
+	accepted := AcceptedMediaTypes(r)
+	if accepted == nil {
 		// RFC 2616 14.1 specifies that the absence of an Accept header shall
 		// be interpreted as */*.
-		return true
+		if len(offered) == 0 {
+			return "", false
+		}
+		return offered[0], true
+	}
+
+	best, bestQ, bestExact := "", 0.0, false
+	for _, offer := range offered {
+		q, exact := acceptQuality(accepted, ParseMediaType(offer))
+		// Prefer offers named explicitly over those matched through
+		// their structured syntax suffix.
+		if q > bestQ || (q == bestQ && exact && !bestExact) {
+			best, bestQ, bestExact = offer, q, exact
+		}
 	}
-	targetContentType := parseMimeType(contentType)
-	for _, value := range values {
+	return best, bestQ > 0
+}
+
+// AcceptedMediaTypes returns the media ranges from the Accept header of r,
+// ordered by decreasing q-value. The result is nil if r does not have an
+// Accept header or if it is blank.
+func AcceptedMediaTypes(r *http.Request) []*MediaType {
+	var accepted []*MediaType
+	for _, value := range r.Header[http.CanonicalHeaderKey("Accept")] {
 		for _, raw := range strings.Split(value, ",") {
-			accepted := parseMimeType(raw)
-			if accepted.Matches(targetContentType) {
-				return true
+			if strings.TrimSpace(raw) == "" {
+				continue
+			}
+			if mediaType := ParseMediaType(raw); mediaType.Q >= 0 {
+				accepted = append(accepted, mediaType)
 			}
 		}
 	}
-
-	return false
+	sort.Stable(byQuality(accepted))
+	return accepted
 }
 
-// ContainsContentType returns true if the requests content type matches
-// contentType, otherwise false.
-//
-// Note that contentType may be a wildcard.
-func ContainsContentType(r *http.Request, contentType string) bool {
-	target := parseMimeType(contentType)
-	header := r.Header.Get("Content-Type")
-	return target.Matches(parseMimeType(header))
+// acceptQuality returns the q-value of the most specific media range in
+// accepted which matches offer, or 0 if there is none, and whether that
+// range names the subtype of offer exactly.
+func acceptQuality(accepted []*MediaType, offer *MediaType) (float64, bool) {
+	q, specificity, exact := 0.0, -1, false
+	for _, mediaRange := range accepted {
+		if s := mediaRange.specificity(); s > specificity && mediaRange.matches(offer, true) {
+			q, specificity, exact = mediaRange.Q, s, mediaRange.SubType == offer.SubType
+		}
+	}
+	return q, exact
 }
 
-type mimeType struct {
+// MediaType is a parsed media type or media range such as
+// "text/html; charset=utf-8", as used in the Accept and Content-Type
+// headers.
+type MediaType struct {
 	Type, SubType string
+
+	// Params holds the parameters of the media type with lower case
+	// names. The q-value of a media range in an Accept header and any
+	// accept extensions after it are not included.
+	Params map[string]string
+
+	// Q is the q-value of a media range in an Accept header, which is 1
+	// if not given and negative if invalid.
+	Q float64
 }
 
-func parseMimeType(raw string) *mimeType {
-	// Since we're not really doing content negotiation, we can safely
-	// ignore parameters.
-	parts := strings.Split(strings.Trim(raw, " "), ";")
-	typeParts := strings.Split(strings.Trim(parts[0], " "), "/")
+// ParseMediaType parses raw, which may be a media type or a media range
+// from an Accept header. Since the result is only used for matching,
+// parsing is lenient: invalid media types result in an empty Type or
+// SubType, which never match.
+func ParseMediaType(raw string) *MediaType {
+	parts := strings.Split(strings.TrimSpace(raw), ";")
+	typeParts := strings.Split(strings.ToLower(strings.TrimSpace(parts[0])), "/")
 	subType := ""
 	if len(typeParts) > 1 {
-		subType = typeParts[1]
+		subType = strings.TrimSpace(typeParts[1])
 	} else if len(typeParts) == 1 && typeParts[0] == "*" {
 		// Apparently some old/broken implementations will do this.
 		subType = "*"
 	}
 
-	return &mimeType{
-		typeParts[0], subType,
+	mediaType := &MediaType{
+		Type:    strings.TrimSpace(typeParts[0]),
+		SubType: subType,
+		Q:       1,
 	}
+	for _, param := range parts[1:] {
+		name, value := param, ""
+		if i := strings.Index(param, "="); i >= 0 {
+			name, value = param[:i], unquote(strings.TrimSpace(param[i+1:]))
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == "q" {
+			q, err := strconv.ParseFloat(value, 64)
+			if err != nil || q < 0 || q > 1 {
+				q = -1
+			}
+			mediaType.Q = q
+			break
+		}
+		if mediaType.Params == nil {
+			mediaType.Params = make(map[string]string)
+		}
+		mediaType.Params[name] = value
+	}
+	return mediaType
 }
 
-func (mime *mimeType) Matches(target *mimeType) bool {
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	var buf []byte
+	for i := 1; i < len(value)-1; i++ {
+		if value[i] == '\\' && i+1 < len(value)-1 {
+			i++
+		}
+		buf = append(buf, value[i])
+	}
+	return string(buf)
+}
+
+// Suffix returns the structured syntax suffix of the media type (RFC 6839),
+// for example "json" for "application/merge-patch+json", or an empty
+// string.
+func (mediaType *MediaType) Suffix() string {
+	if i := strings.LastIndex(mediaType.SubType, "+"); i >= 0 {
+		return mediaType.SubType[i+1:]
+	}
+	return ""
+}
+
+// Param returns the value of the named parameter, or an empty string.
+func (mediaType *MediaType) Param(name string) string {
+	return mediaType.Params[strings.ToLower(name)]
+}
+
+// Charset returns the lower cased charset parameter, or an empty string.
+func (mediaType *MediaType) Charset() string {
+	return strings.ToLower(mediaType.Param("charset"))
+}
+
+// Matches returns true if target, a media type, is within the media range
+// described by mediaType.
+//
+// Besides wildcards, structured syntax suffixes are taken into account:
+// "application/json" matches "application/merge-patch+json" and
+// "application/*+json" matches any JSON based application type.
+// Parameters of mediaType, such as charset or version, must be present
+// in target with the same value.
+func (mediaType *MediaType) Matches(target *MediaType) bool {
+	return mediaType.matches(target, false)
+}
+
+// matches implements Matches. If ignoreCharset is true, a charset
+// parameter of mediaType is only compared if target has one as well, which
+// is how media ranges of the Accept header apply to offers.
+func (mediaType *MediaType) matches(target *MediaType, ignoreCharset bool) bool {
 	// Invalid mime types should never be matched.
-	if target.Type == "" || target.SubType == "" {
+	if target.Type == "" || target.SubType == "" || mediaType.SubType == "" {
+		return false
+	}
+
+	switch {
+	case mediaType.SubType == "*":
+		if target.Type != mediaType.Type && mediaType.Type != "*" {
+			return false
+		}
+	case target.Type != mediaType.Type:
+		return false
+	case target.SubType == mediaType.SubType:
+	case strings.HasPrefix(mediaType.SubType, "*+"):
+		if target.Suffix() != mediaType.SubType[2:] {
+			return false
+		}
+	case mediaType.Suffix() != "" || target.Suffix() != mediaType.SubType:
 		return false
 	}
 
-	if mime.SubType == "*" {
-		return target.Type == mime.Type || mime.Type == "*"
+	for name, value := range mediaType.Params {
+		targetValue, ok := target.Params[name]
+		if !ok && ignoreCharset && name == "charset" {
+			continue
+		}
+		if !ok || !paramValueEqual(name, value, targetValue) {
+			return false
+		}
 	}
-	return target.Type == mime.Type && target.SubType == mime.SubType
+	return true
 }
 
-func (mime *mimeType) String() string {
-	return mime.Type + "/" + mime.SubType
+func paramValueEqual(name, a, b string) bool {
+	if name == "charset" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
 }
+
+// specificity ranks media ranges, more specific ones override less
+// specific ones when determining the q-value of a media type.
+func (mediaType *MediaType) specificity() int {
+	switch {
+	case mediaType.Type == "*":
+		return len(mediaType.Params)
+	case mediaType.SubType == "*":
+		return 100 + len(mediaType.Params)
+	case strings.HasPrefix(mediaType.SubType, "*+"):
+		return 150 + len(mediaType.Params)
+	}
+	return 200 + len(mediaType.Params)
+}
+
+// String returns the media type in its canonical form, including its
+// parameters but not the q-value.
+func (mediaType *MediaType) String() string {
+	s := mediaType.Type + "/" + mediaType.SubType
+	names := make([]string, 0, len(mediaType.Params))
+	for name := range mediaType.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s += "; " + name + "=" + quoteIfNeeded(mediaType.Params[name])
+	}
+	return s
+}
+
+func quoteIfNeeded(value string) string {
+	if value != "" && strings.IndexFunc(value, func(r rune) bool {
+		return r <= ' ' || r >= 0x7f || strings.ContainsRune("()<>@,;:\\\"/[]?={}", r)
+	}) < 0 {
+		return value
+	}
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(value) + "\""
+}
+
+type byQuality []*MediaType
+
+func (s byQuality) Len() int           { return len(s) }
+func (s byQuality) Less(i, j int) bool { return s[i].Q > s[j].Q }
+func (s byQuality) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -90,3 +90,123 @@ func Test_ContainsContentType_SucceedsForMatchingContentTypes(t *testing.T) {
 		}
 	}
 }
+
+func Test_Negotiate_ReturnsFirstOfferIfNoHeaderIsPresent(t *testing.T) {
+	r, _ := http.NewRequest("", "", nil)
+	if offer, ok := Negotiate(r, "application/json", "text/html"); !ok || offer != "application/json" {
+		t.Errorf("Expected first offer to be selected, but got %s", offer)
+	}
+}
+
+func Test_Negotiate_SelectsTheBestOffer(t *testing.T) {
+	for _, test := range []struct {
+		accept, expected string
+	}{
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html"},
+		{"*/*", "application/json"},
+		{"application/xml, application/json;q=0.5", "application/xml"},
+		{"text/*;q=0.3, application/json;q=0.2", "text/html"},
+		{"application/*;q=0.9, application/json;q=0", "application/xml"},
+		{"*/*, application/json;q=0", "text/html"},
+		{"text/html;level=1, text/html;q=0.1, */*;q=0.5", "application/json"},
+		{"TEXT/HTML", "text/html"},
+	} {
+		r, _ := http.NewRequest("", "", nil)
+		r.Header.Add("Accept", test.accept)
+		offer, ok := Negotiate(r, "application/json", "text/html", "application/xml")
+		if !ok || offer != test.expected {
+			t.Errorf("Expected %s to be selected for %s, but got %s", test.expected, test.accept, offer)
+		}
+	}
+}
+
+func Test_Negotiate_FailsIfNothingIsAcceptable(t *testing.T) {
+	for _, accept := range []string{
+		"image/png",
+		"application/json;q=0, text/html;q=0",
+		"text/*, text/html;q=0",
+	} {
+		r, _ := http.NewRequest("", "", nil)
+		r.Header.Add("Accept", accept)
+		if offer, ok := Negotiate(r, "application/json", "text/html"); ok {
+			t.Errorf("Expected no offer to be acceptable for %s, but got %s", accept, offer)
+		}
+	}
+}
+
+func Test_Negotiate_MatchesParameters(t *testing.T) {
+	r, _ := http.NewRequest("", "", nil)
+	r.Header.Add("Accept", "text/plain; charset=\"UTF-8\"")
+	if offer, _ := Negotiate(r, "text/plain; charset=iso-8859-1", "text/plain; charset=utf-8"); offer != "text/plain; charset=utf-8" {
+		t.Errorf("Expected offer with matching parameters to be selected, but got %s", offer)
+	}
+}
+
+func Test_ParseMediaType(t *testing.T) {
+	mediaType := ParseMediaType(`Application/Vnd.Acme+JSON; Version=2; title="a \"b\""; q=0.5; ext=1`)
+	if actual, expected := mediaType.String(), `application/vnd.acme+json; title="a \"b\""; version=2`; actual != expected {
+		t.Errorf("Expected media type to be %s, but was %s", expected, actual)
+	}
+	if mediaType.Q != 0.5 {
+		t.Errorf("Expected q-value of 0.5, but was %v", mediaType.Q)
+	}
+}
+
+func Test_ContainsContentType_MatchesStructuredSyntaxSuffixes(t *testing.T) {
+	r, _ := http.NewRequest("", "", nil)
+	r.Header.Add("Content-Type", "application/merge-patch+json; charset=UTF-8")
+	for targetContentType, expected := range map[string]bool{
+		"application/json":                       true,
+		"application/*+json":                     true,
+		"application/merge-patch+json":           true,
+		"application/json; charset=utf-8":        true,
+		"application/json; charset=iso-8859-1":   false,
+		"application/xml":                        false,
+		"application/*+xml":                      false,
+		"application/vnd.acme+json":              false,
+		"text/json":                              false,
+		"application/merge-patch+json;version=1": false,
+	} {
+		if actual := ContainsContentType(r, targetContentType); actual != expected {
+			t.Errorf("Expected match of %s to be %v, but was %v", targetContentType, expected, actual)
+		}
+	}
+}
+
+func Test_AcceptsContentType_MatchesVersionParameters(t *testing.T) {
+	r, _ := http.NewRequest("", "", nil)
+	r.Header.Add("Accept", "application/vnd.acme+json; version=2")
+	if !AcceptsContentType(r, "application/vnd.acme+json; version=2; charset=utf-8") {
+		t.Error("Expected matching version to be accepted")
+	}
+	if AcceptsContentType(r, "application/vnd.acme+json; version=1") {
+		t.Error("Expected other version not to be accepted")
+	}
+}
+
+func Test_AcceptsContentType_IgnoresCharsetOfRangeForOffersWithout(t *testing.T) {
+	for _, accept := range []string{"application/json; charset=utf-8", "application/json; q=0.9; charset=utf-8"} {
+		r, _ := http.NewRequest("", "", nil)
+		r.Header.Add("Accept", accept)
+		if !AcceptsContentType(r, "application/json") {
+			t.Errorf("Expected application/json to be accepted for '%s'", accept)
+		}
+	}
+
+	r, _ := http.NewRequest("", "", nil)
+	r.Header.Add("Accept", "application/json; charset=utf-8")
+	if AcceptsContentType(r, "application/json; charset=iso-8859-1") {
+		t.Error("Expected offer with other charset not to be accepted")
+	}
+}
+
+func Test_Negotiate_PrefersExactSubtypesOverSuffixMatches(t *testing.T) {
+	r, _ := http.NewRequest("", "", nil)
+	r.Header.Add("Accept", "application/json")
+	if offer, _ := Negotiate(r, "application/problem+json", "application/json"); offer != "application/json" {
+		t.Errorf("Expected application/json to be selected, but got %s", offer)
+	}
+	if offer, _ := Negotiate(r, "application/problem+json", "text/plain"); offer != "application/problem+json" {
+		t.Errorf("Expected application/problem+json to be selected, but got %s", offer)
+	}
+}
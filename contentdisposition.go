@@ -0,0 +1,100 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Approximations of common non-ASCII letters for the plain filename
+// parameter, used by clients which don't understand filename*.
+var asciiReplacements = map[rune]string{
+	'Ä': "Ae", 'Ö': "Oe", 'Ü': "Ue", 'ä': "ae", 'ö': "oe", 'ü': "ue", 'ß': "ss",
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Å': "A", 'Æ': "AE", 'Ç': "C",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I",
+	'Ñ': "N", 'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ø': "O",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ý': "Y",
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'å': "a", 'æ': "ae", 'ç': "c",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ñ': "n", 'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ø': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ý': "y", 'ÿ': "y",
+}
+
+// ContentDisposition returns a Content-Disposition header value with the
+// given disposition type, usually "attachment" or "inline", and filename
+// as specified by RFC 6266.
+//
+// Control characters and path separators are removed from filename. If
+// the name is not plain ASCII, it is sent UTF-8 encoded in the filename*
+// parameter (RFC 5987), with an ASCII approximation in the filename
+// parameter for clients not supporting it.
+func ContentDisposition(disposition, filename string) string {
+	filename = sanitizeFilename(filename)
+	if filename == "" {
+		return disposition
+	}
+
+	var fallback []byte
+	needsExtended := false
+	for _, r := range filename {
+		switch {
+		case r == '"' || r == '\\':
+			fallback = append(fallback, '\\', byte(r))
+		case r < utf8.RuneSelf:
+			fallback = append(fallback, byte(r))
+		default:
+			needsExtended = true
+			if replacement, ok := asciiReplacements[r]; ok {
+				fallback = append(fallback, replacement...)
+			} else {
+				fallback = append(fallback, '_')
+			}
+		}
+	}
+
+	value := disposition + "; filename=\"" + string(fallback) + "\""
+	if needsExtended {
+		value += "; filename*=UTF-8''" + encodeExtValue(filename)
+	}
+	return value
+}
+
+func sanitizeFilename(filename string) string {
+	filename = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\':
+			return '_'
+		case unicode.IsControl(r) || r == utf8.RuneError:
+			return -1
+		}
+		return r
+	}, filename)
+	return strings.TrimSpace(filename)
+}
+
+// encodeExtValue percent encodes s as value-chars of RFC 5987.
+func encodeExtValue(s string) string {
+	const hex = "0123456789ABCDEF"
+	var buf []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			buf = append(buf, c)
+		} else {
+			buf = append(buf, '%', hex[c>>4], hex[c&0xf])
+		}
+	}
+	return string(buf)
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
@@ -0,0 +1,57 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestContentDisposition(t *testing.T) {
+	for filename, expected := range map[string]string{
+		"report.pdf":            `attachment; filename="report.pdf"`,
+		`say "hi".txt`:          `attachment; filename="say \"hi\".txt"`,
+		"Übersicht März.pdf":    `attachment; filename="Uebersicht Maerz.pdf"; filename*=UTF-8''%C3%9Cbersicht%20M%C3%A4rz.pdf`,
+		"€ rates.csv":           `attachment; filename="_ rates.csv"; filename*=UTF-8''%E2%82%AC%20rates.csv`,
+		"evil\r\nSet-Cookie: x": `attachment; filename="evilSet-Cookie: x"`,
+		"../../etc/passwd":      `attachment; filename=".._.._etc_passwd"`,
+		"\r\n":                  `attachment`,
+	} {
+		if actual := ContentDisposition("attachment", filename); actual != expected {
+			t.Errorf("Expected Content-Disposition for %q to be %s, but was %s", filename, expected, actual)
+		}
+	}
+}
+
+func TestFileDownloadServer_DownloadName(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "1234.bin"), []byte("data"), 0644)
+	options := &DownloadOptions{NameParameter: "name"}
+
+	for url, expected := range map[string]string{
+		"/1234.bin":                       `attachment; filename="1234.bin"`,
+		"/1234.bin?name=Pr%C3%BCfung.txt": `attachment; filename="Pruefung.txt"; filename*=UTF-8''Pr%C3%BCfung.txt`,
+	} {
+		r, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		FileDownloadServerWithOptions(http.Dir(dir), options).ServeHTTP(w, r)
+		if actual := w.Header().Get("Content-Disposition"); actual != expected {
+			t.Errorf("Expected Content-Disposition for %s to be %s, but was %s", url, expected, actual)
+		}
+	}
+
+	options.Name = func(r *http.Request, path string) string {
+		return "named by callback.bin"
+	}
+	r, _ := http.NewRequest("GET", "/1234.bin?name=other", nil)
+	w := httptest.NewRecorder()
+	FileDownloadServerWithOptions(http.Dir(dir), options).ServeHTTP(w, r)
+	if actual, expected := w.Header().Get("Content-Disposition"), `attachment; filename="named by callback.bin"`; actual != expected {
+		t.Errorf("Expected Content-Disposition to be %s, but was %s", expected, actual)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MakeContentTypeHandler wraps handler such that it is only called for
+// requests which accept one of the media types in produces and, if they
+// have a body, whose Content-Type is one of the media types in consumes.
+//
+// Other requests are rejected with 406 Not Acceptable or 415 Unsupported
+// Media Type respectively. The latter lists the consumed media types in
+// the Accept header of the response, and depending on the method also in
+// Accept-Post or Accept-Patch. Error bodies are sent as plain text or as
+// problem details objects (RFC 9457), whichever the client prefers.
+//
+// An empty produces or consumes disables the respective check.
+func MakeContentTypeHandler(handler http.HandlerFunc, produces, consumes []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(produces) > 0 {
+			addVary(w.Header(), "Accept")
+			if _, ok := Negotiate(r, produces...); !ok {
+				writeContentTypeError(w, r, http.StatusNotAcceptable, produces)
+				return
+			}
+		}
+
+		if len(consumes) > 0 && hasBody(r) && !containsAnyContentType(r, consumes) {
+			accept := strings.Join(consumes, ", ")
+			w.Header().Set("Accept", accept)
+			switch r.Method {
+			case "POST":
+				w.Header().Set("Accept-Post", accept)
+			case "PATCH":
+				w.Header().Set("Accept-Patch", accept)
+			}
+			writeContentTypeError(w, r, http.StatusUnsupportedMediaType, consumes)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func hasBody(r *http.Request) bool {
+	return r.ContentLength > 0 || (r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody)
+}
+
+func containsAnyContentType(r *http.Request, contentTypes []string) bool {
+	for _, contentType := range contentTypes {
+		if ContainsContentType(r, contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeContentTypeError responds with status and the list of supported
+// media types in a format acceptable to the client.
+func writeContentTypeError(w http.ResponseWriter, r *http.Request, status int, supported []string) {
+	detail := fmt.Sprintf("Supported media types: %s", strings.Join(supported, ", "))
+	if format, ok := Negotiate(r, "text/plain", ProblemJSONType, ProblemXMLType); ok && format != "text/plain" {
+		problem := NewProblem(status, detail)
+		problem.Extensions = map[string]interface{}{"supported": supported}
+		WriteProblem(w, r, problem)
+		return
+	}
+	http.Error(w, fmt.Sprintf("%d %s\n%s", status, http.StatusText(status), detail), status)
+}
@@ -0,0 +1,67 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMakeContentTypeHandler(t *testing.T) {
+	handler := MakeContentTypeHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}, []string{"application/json"}, []string{"application/json", "application/x-www-form-urlencoded"})
+
+	for _, test := range []struct {
+		method, accept, contentType, body string
+		status                            int
+	}{
+		{"GET", "", "", "", http.StatusNoContent},
+		{"GET", "text/html", "", "", http.StatusNotAcceptable},
+		{"POST", "application/*", "application/merge-patch+json", "{}", http.StatusNoContent},
+		{"POST", "*/*", "text/xml", "<a/>", http.StatusUnsupportedMediaType},
+		{"POST", "*/*", "", "", http.StatusNoContent},
+		{"PATCH", "*/*", "", "x", http.StatusUnsupportedMediaType},
+	} {
+		r, _ := http.NewRequest(test.method, "/", strings.NewReader(test.body))
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != test.status {
+			t.Errorf("Expected %s with Accept '%s' and Content-Type '%s' to return %d, but was %d", test.method, test.accept, test.contentType, test.status, w.Code)
+		}
+		if w.Code == http.StatusUnsupportedMediaType {
+			if accept := w.Header().Get("Accept"); accept != "application/json, application/x-www-form-urlencoded" {
+				t.Errorf("Unexpected Accept header '%s'", accept)
+			}
+			if test.method == "PATCH" && w.Header().Get("Accept-Patch") == "" {
+				t.Error("Expected Accept-Patch header to be set")
+			}
+		}
+	}
+}
+
+func TestMakeContentTypeHandler_NegotiatesErrorBody(t *testing.T) {
+	handler := MakeContentTypeHandler(nil, []string{"text/csv"}, nil)
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected JSON error body, but got '%s'", w.Body.String())
+	}
+	if body["status"] != float64(http.StatusNotAcceptable) {
+		t.Errorf("Unexpected error body %v", body)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Digest algorithms supported by DigestCache, as registered with IANA.
+const (
+	DigestSHA256 = "sha-256"
+	DigestSHA512 = "sha-512"
+)
+
+var digestHashes = map[string]func() hash.Hash{
+	DigestSHA256: sha256.New,
+	DigestSHA512: sha512.New,
+}
+
+// DigestCache provides integrity digests of file contents to
+// ServeFileWithOptions, which sends them in both the Repr-Digest (RFC 9530)
+// and the Digest (RFC 3230) header.
+//
+// Clients select the algorithm with the Want-Repr-Digest or Want-Digest
+// request headers. Digests are remembered by path, size and modification
+// time of the file. Use a separate DigestCache for each file system.
+type DigestCache struct {
+	hashes     *contentHashCache
+	algorithms []string
+}
+
+// NewDigestCache returns a DigestCache remembering up to maxEntries
+// digests, offering the given algorithms in order of preference. Without
+// algorithms, only DigestSHA256 is offered.
+func NewDigestCache(maxEntries int, algorithms ...string) *DigestCache {
+	var supported []string
+	for _, algorithm := range algorithms {
+		algorithm = strings.ToLower(algorithm)
+		if _, ok := digestHashes[algorithm]; ok {
+			supported = append(supported, algorithm)
+		}
+	}
+	if len(supported) == 0 {
+		supported = []string{DigestSHA256}
+	}
+	return &DigestCache{newContentHashCache(maxEntries), supported}
+}
+
+// SetDigestHeaders sets the digest headers for the file with the given
+// name and info on w as requested by r, reading content if required. The
+// read position of content is reset afterwards.
+func (c *DigestCache) SetDigestHeaders(w http.ResponseWriter, r *http.Request, name string, fi os.FileInfo, content io.ReadSeeker) error {
+	algorithm := c.selectAlgorithm(r)
+	if algorithm == "" {
+		return nil
+	}
+	sum, err := c.hashes.sum(name, fi, content, algorithm, digestHashes[algorithm])
+	if err != nil {
+		return err
+	}
+	value := base64.StdEncoding.EncodeToString(sum)
+	w.Header().Set("Repr-Digest", algorithm+"=:"+value+":")
+	w.Header().Set("Digest", algorithm+"="+value)
+	return nil
+}
+
+// selectAlgorithm returns the offered algorithm preferred by the client,
+// or an empty string if it accepts none of them.
+func (c *DigestCache) selectAlgorithm(r *http.Request) string {
+	var preferences map[string]float64
+	if value := r.Header.Get("Want-Repr-Digest"); value != "" {
+		// RFC 9530: sha-256=5, sha-512=10 with preferences from 0 to 10.
+		preferences = parseDigestPreferences(value, "=")
+	} else if value := r.Header.Get("Want-Digest"); value != "" {
+		// RFC 3230: sha-256;q=0.5, sha-512 with optional q-values.
+		preferences = parseDigestPreferences(value, ";q=")
+	} else {
+		return c.algorithms[0]
+	}
+
+	best, bestPreference := "", 0.0
+	for _, algorithm := range c.algorithms {
+		if preference := preferences[algorithm]; preference > bestPreference {
+			best, bestPreference = algorithm, preference
+		}
+	}
+	return best
+}
+
+func parseDigestPreferences(value, separator string) map[string]float64 {
+	preferences := make(map[string]float64)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.Replace(item, " ", "", -1))
+		preference := 1.0
+		if i := strings.Index(item, separator); i >= 0 {
+			var err error
+			if preference, err = strconv.ParseFloat(item[i+len(separator):], 64); err != nil {
+				continue
+			}
+			item = item[:i]
+		}
+		preferences[item] = preference
+	}
+	return preferences
+}
@@ -0,0 +1,54 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestServeFileWithOptions_Digests(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("verify me")
+	ioutil.WriteFile(filepath.Join(dir, "file.txt"), content, 0644)
+	sum256 := sha256.Sum256(content)
+	sum512 := sha512.Sum512(content)
+	sha256Value := base64.StdEncoding.EncodeToString(sum256[:])
+	sha512Value := base64.StdEncoding.EncodeToString(sum512[:])
+	options := &DownloadOptions{FileOptions: FileOptions{Digests: NewDigestCache(10, DigestSHA256, DigestSHA512)}}
+
+	for _, test := range []struct {
+		header, value, expected string
+	}{
+		{"", "", "sha-256=" + sha256Value},
+		{"Want-Digest", "SHA-512;q=0.3, sha-256;q=0.1", "sha-512=" + sha512Value},
+		{"Want-Digest", "md5", ""},
+		{"Want-Repr-Digest", "sha-256=1, sha-512=3", "sha-512=" + sha512Value},
+		{"Want-Repr-Digest", "sha-256=4, sha-512=0", "sha-256=" + sha256Value},
+	} {
+		r, _ := http.NewRequest("GET", "/file.txt", nil)
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+		w := httptest.NewRecorder()
+		FileDownloadServerWithOptions(http.Dir(dir), options).ServeHTTP(w, r)
+		if actual := w.Header().Get("Digest"); actual != test.expected {
+			t.Errorf("Expected Digest for %s '%s' to be '%s', but was '%s'", test.header, test.value, test.expected, actual)
+		}
+		expectedRepr := ""
+		if test.expected != "" {
+			expectedRepr = test.expected[:8] + ":" + test.expected[8:] + ":"
+		}
+		if actual := w.Header().Get("Repr-Digest"); actual != expectedRepr {
+			t.Errorf("Expected Repr-Digest for %s '%s' to be '%s', but was '%s'", test.header, test.value, expectedRepr, actual)
+		}
+	}
+}
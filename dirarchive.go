@@ -0,0 +1,190 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+)
+
+var errArchiveTooLarge = errors.New("archive too large")
+
+// Archive formats in which FileDownloadServerWithOptions can send
+// directories.
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+type dirArchiveEntry struct {
+	name string
+	path string
+	info os.FileInfo
+}
+
+// serveDirArchive responds to w with the contents of the directory dir
+// within root as an archive in the given format. The returned error tells
+// whether streaming the archive failed.
+func serveDirArchive(w http.ResponseWriter, r *http.Request, root http.FileSystem, dir, format, name string, options *DownloadOptions) error {
+	entries, err := collectDirArchiveEntries(root, dir, options)
+	switch err {
+	case nil:
+	case errArchiveTooLarge:
+		detail := fmt.Sprintf("The directory exceeds the maximum archive size of %d bytes.", options.MaxArchiveSize)
+		httpErrorDetail(w, r, http.StatusForbidden, detail, options.ProblemDetails)
+		return nil
+	default:
+		httpError(w, r, http.StatusNotFound, options.ProblemDetails)
+		return nil
+	}
+
+	h := w.Header()
+	h.Set("Content-Disposition", ContentDisposition("attachment", name))
+	if format == ArchiveZip {
+		h.Set("Content-Type", "application/zip")
+	} else {
+		h.Set("Content-Type", "application/gzip")
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == "HEAD" {
+		return nil
+	}
+
+	// Errors can no longer be reported once streaming has begun, the
+	// client will notice the truncated archive.
+	if format == ArchiveZip {
+		return writeZipArchive(w, root, entries)
+	}
+	return writeTarGzArchive(w, root, entries)
+}
+
+// collectDirArchiveEntries returns all files and directories below dir
+// which are not denied, making sure their total size is within limits.
+func collectDirArchiveEntries(root http.FileSystem, dir string, options *DownloadOptions) ([]dirArchiveEntry, error) {
+	var entries []dirArchiveEntry
+	var total int64
+	var walk func(dirPath, prefix string) error
+	walk = func(dirPath, prefix string) error {
+		d, err := root.Open(dirPath)
+		if err != nil {
+			return err
+		}
+		infos, err := d.Readdir(-1)
+		d.Close()
+		if err != nil {
+			return err
+		}
+		sort.Sort(byName(infos))
+		for _, info := range infos {
+			name := path.Join(prefix, info.Name())
+			fsPath := path.Join(dirPath, info.Name())
+			if info.Mode()&os.ModeSymlink != 0 {
+				// Only follow links to files, directories might loop.
+				if info = statFile(root, fsPath); info == nil || info.IsDir() {
+					continue
+				}
+			}
+			if options.Deny != nil && options.Deny(fsPath, info) {
+				continue
+			}
+			switch {
+			case info.IsDir():
+				entries = append(entries, dirArchiveEntry{name + "/", fsPath, info})
+				if err := walk(fsPath, name); err != nil {
+					return err
+				}
+			case info.Mode().IsRegular():
+				total += info.Size()
+				if options.MaxArchiveSize > 0 && total > options.MaxArchiveSize {
+					return errArchiveTooLarge
+				}
+				entries = append(entries, dirArchiveEntry{name, fsPath, info})
+			}
+		}
+		return nil
+	}
+	return entries, walk(dir, "")
+}
+
+func statFile(root http.FileSystem, name string) os.FileInfo {
+	f, err := root.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+func writeZipArchive(w io.Writer, root http.FileSystem, entries []dirArchiveEntry) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range entries {
+		hdr, err := zip.FileInfoHeader(entry.info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = entry.name
+		if !entry.info.IsDir() {
+			hdr.Method = zip.Deflate
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if !entry.info.IsDir() {
+			if err := copyArchiveFile(fw, root, entry); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGzArchive(w io.Writer, root http.FileSystem, entries []dirArchiveEntry) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	for _, entry := range entries {
+		hdr, err := tar.FileInfoHeader(entry.info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = entry.name
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !entry.info.IsDir() {
+			if err := copyArchiveFile(tw, root, entry); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// copyArchiveFile writes exactly as many bytes as announced by the
+// directory listing, failing if the file has changed in the meantime.
+func copyArchiveFile(w io.Writer, root http.FileSystem, entry dirArchiveEntry) error {
+	f, err := root.Open(entry.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyN(w, f, entry.info.Size())
+	return err
+}
@@ -0,0 +1,85 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestFileDownloadServer_DirectoryArchives(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"reports/2014/q1.csv":  "a,b",
+		"reports/2014/q2.csv":  "c,d",
+		"reports/.secret":      "hidden",
+		"reports/readme.txt":   "hello",
+		"other/unrelated.file": "x",
+	})
+	options := &DownloadOptions{
+		DirectoryArchives: true,
+		Deny: func(name string, fi os.FileInfo) bool {
+			return strings.HasPrefix(path.Base(name), ".")
+		},
+	}
+	handler := FileDownloadServerWithOptions(http.Dir(dir), options)
+	expected := "2014/ 2014/q1.csv 2014/q2.csv readme.txt"
+
+	r, _ := http.NewRequest("GET", "/reports", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if disposition := w.Header().Get("Content-Disposition"); disposition != `attachment; filename="reports.zip"` {
+		t.Errorf("Unexpected Content-Disposition %s", disposition)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip archive: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if actual := strings.Join(names, " "); actual != expected {
+		t.Errorf("Expected zip archive to contain '%s', but was '%s'", expected, actual)
+	}
+
+	r, _ = http.NewRequest("GET", "/reports?format=tar.gz", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	gr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Failed to read tar.gz archive: %v", err)
+	}
+	tr := tar.NewReader(gr)
+	names = nil
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Failed to read tar.gz archive: %v", err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if actual := strings.Join(names, " "); actual != expected {
+		t.Errorf("Expected tar.gz archive to contain '%s', but was '%s'", expected, actual)
+	}
+
+	options.MaxArchiveSize = 10
+	r, _ = http.NewRequest("GET", "/reports", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "maximum archive size of 10 bytes") {
+		t.Errorf("Expected archive exceeding the size limit to return %d with detail, but got %d '%s'", http.StatusForbidden, w.Code, w.Body.String())
+	}
+}
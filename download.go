@@ -6,12 +6,69 @@ package httputils
 
 import (
 	"net/http"
+	"os"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// DownloadOptions configures the handler returned by
+// FileDownloadServerWithOptions.
+type DownloadOptions struct {
+	FileOptions
+
+	// NameParameter, when set, is the name of a query parameter which
+	// overrides the file name sent to the client.
+	NameParameter string
+
+	// Name, when set, returns the file name sent to the client for the
+	// requested path. It takes precedence over NameParameter, unless it
+	// returns an empty string.
+	Name func(r *http.Request, path string) string
+
+	// DirectoryArchives enables sending requested directories as an
+	// archive generated on the fly, instead of refusing them. Clients can
+	// select the archive format through the format query parameter.
+	DirectoryArchives bool
+
+	// ArchiveFormat is the archive format used for directories when the
+	// client does not select one, ArchiveZip if empty.
+	ArchiveFormat string
+
+	// MaxArchiveSize, when set, is the maximum total size of the files
+	// within a directory archive. Larger directories are answered with
+	// 403 Forbidden and a detail naming the limit.
+	MaxArchiveSize int64
+
+	// OnComplete, when set, is called after every response with its
+	// details, for example to keep an audit log of downloads.
+	OnComplete func(event *DownloadEvent)
+}
+
+// DownloadEvent describes a response of FileDownloadServerWithOptions.
+type DownloadEvent struct {
+	Request *http.Request
+
+	// Path is the cleaned path of the requested file within root.
+	Path string
+
+	Status       int
+	BytesWritten int64
+
+	// Range is the Content-Range of a partial response, empty otherwise.
+	Range string
+
+	Duration time.Duration
+
+	// Completed is true if the response was sent successfully and in
+	// full, false if it failed or the client went away.
+	Completed bool
+}
+
 type fileDownloadHandler struct {
-	root http.FileSystem
+	root    http.FileSystem
+	options *DownloadOptions
 }
 
 // FileDownloadServer returns a handler that serves HTTP requests
@@ -22,8 +79,20 @@ type fileDownloadHandler struct {
 // use http.Dir:
 //
 //     http.Handle("/", http.FileStaticServer(http.Dir("/tmp")))
+//
+// Use ConfinedDir instead of http.Dir to prevent symbolic links from
+// exposing files outside of root.
 func FileDownloadServer(root http.FileSystem) http.Handler {
-	return &fileDownloadHandler{root}
+	return &fileDownloadHandler{root, &DownloadOptions{}}
+}
+
+// FileDownloadServerWithOptions is like FileDownloadServer, with files
+// being served as configured by options.
+func FileDownloadServerWithOptions(root http.FileSystem, options *DownloadOptions) http.Handler {
+	if options == nil {
+		options = &DownloadOptions{}
+	}
+	return &fileDownloadHandler{root, options}
 }
 
 func (f *fileDownloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -34,16 +103,104 @@ func (f *fileDownloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		r.URL.Path = upath
 	}
 
-	handler := func(w http.ResponseWriter, r *http.Request) {
+	handler := func(w http.ResponseWriter, r *http.Request) error {
 
 		upath = path.Clean(upath)
-		_, fn := path.Split(upath)
-		w.Header().Set("Content-Disposition", "attachment;filename=\""+fn+"\"")
+		w.Header().Set("Content-Disposition", ContentDisposition("attachment", f.downloadName(r, upath)))
+
+		var serveDir func(fileinfo os.FileInfo) error
+		if f.options.DirectoryArchives {
+			serveDir = func(fileinfo os.FileInfo) error {
+				w.Header().Del("Content-Disposition")
+				return f.serveArchive(w, r, upath, fileinfo)
+			}
+		}
+		return serveFile(w, r, f.root, upath, &f.options.FileOptions, serveDir)
 
-		ServeFile(w, r, f.root, upath)
+	}
+
+	if f.options.OnComplete == nil {
+		handler(w, r)
+		return
+	}
+
+	start := time.Now()
+	sw := &statusWriter{ResponseWriter: w}
+	err := handler(sw, r)
+	f.options.OnComplete(&DownloadEvent{
+		Request:      r,
+		Path:         upath,
+		Status:       sw.Status(),
+		BytesWritten: sw.written,
+		Range:        sw.Header().Get("Content-Range"),
+		Duration:     time.Since(start),
+		Completed:    err == nil && isCompleted(r, sw),
+	})
+
+}
+
+// isCompleted returns true if the response recorded by sw was successful
+// and its body was written in full.
+func isCompleted(r *http.Request, sw *statusWriter) bool {
+	if sw.err != nil || sw.Status() < 200 || sw.Status() >= 300 {
+		return false
+	}
+	if length := sw.Header().Get("Content-Length"); length != "" && r.Method != "HEAD" {
+		n, err := strconv.ParseInt(length, 10, 64)
+		return err == nil && n == sw.written
+	}
+	return true
+}
 
+func (f *fileDownloadHandler) serveArchive(w http.ResponseWriter, r *http.Request, upath string, fileinfo os.FileInfo) error {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = f.options.ArchiveFormat
 	}
+	switch format {
+	case "":
+		format = ArchiveZip
+	case ArchiveZip, ArchiveTarGz:
+	default:
+		httpError(w, r, http.StatusBadRequest, f.options.ProblemDetails)
+		return nil
+	}
+
+	if f.options.Deny != nil && f.options.Deny(upath, fileinfo) {
+		httpError(w, r, http.StatusForbidden, f.options.ProblemDetails)
+		return nil
+	}
+
+	name := f.customName(r, upath)
+	if name == "" {
+		if _, name = path.Split(upath); name == "" {
+			name = "download"
+		}
+		name += "." + format
+	}
+	return serveDirArchive(w, r, f.root, upath, format, name, f.options)
+}
 
-	handler(w, r)
+// downloadName returns the file name to be sent to the client.
+func (f *fileDownloadHandler) downloadName(r *http.Request, upath string) string {
+	if name := f.customName(r, upath); name != "" {
+		return name
+	}
+	_, fn := path.Split(upath)
+	return fn
+}
 
+// customName returns the file name requested through options, if any.
+func (f *fileDownloadHandler) customName(r *http.Request, upath string) string {
+	if f.options.Name != nil {
+		if name := f.options.Name(r, upath); name != "" {
+			return name
+		}
+	}
+	if f.options.NameParameter != "" {
+		if name := r.URL.Query().Get(f.options.NameParameter); name != "" {
+			return name
+		}
+	}
+	return ""
 }
@@ -0,0 +1,69 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type failingResponseWriter struct {
+	*httptest.ResponseRecorder
+	remaining int
+}
+
+func (w *failingResponseWriter) Write(b []byte) (int, error) {
+	if len(b) > w.remaining {
+		n, _ := w.ResponseRecorder.Write(b[:w.remaining])
+		w.remaining = 0
+		return n, errors.New("connection reset")
+	}
+	w.remaining -= len(b)
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestFileDownloadServer_OnComplete(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "file.bin"), []byte(strings.Repeat("x", 1000)), 0644)
+	var event *DownloadEvent
+	handler := FileDownloadServerWithOptions(http.Dir(dir), &DownloadOptions{
+		OnComplete: func(e *DownloadEvent) {
+			event = e
+		},
+	})
+
+	for _, test := range []struct {
+		path, rangeHeader string
+		w                 http.ResponseWriter
+		status            int
+		written           int64
+		contentRange      string
+		completed         bool
+	}{
+		{"/file.bin", "", httptest.NewRecorder(), 200, 1000, "", true},
+		{"/file.bin", "bytes=100-199", httptest.NewRecorder(), 206, 100, "bytes 100-199/1000", true},
+		{"/file.bin", "", &failingResponseWriter{httptest.NewRecorder(), 600}, 200, 600, "", false},
+		{"/missing.bin", "", httptest.NewRecorder(), 404, 14, "", false},
+	} {
+		event = nil
+		r, _ := http.NewRequest("GET", test.path, nil)
+		if test.rangeHeader != "" {
+			r.Header.Set("Range", test.rangeHeader)
+		}
+		handler.ServeHTTP(test.w, r)
+		if event == nil {
+			t.Fatalf("OnComplete was not called for %s", test.path)
+		}
+		if event.Path != test.path || event.Status != test.status || event.BytesWritten != test.written ||
+			event.Range != test.contentRange || event.Completed != test.completed {
+			t.Errorf("Unexpected event for %s %s: %+v", test.path, test.rangeHeader, event)
+		}
+	}
+}
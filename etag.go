@@ -0,0 +1,103 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"sync"
+)
+
+// ETagCache provides strong ETags computed from file contents to
+// ServeFileWithOptions.
+//
+// ETags are remembered by path, size and modification time of the file,
+// so that every version of a file only needs to be read once. Use a
+// separate ETagCache for each file system.
+type ETagCache struct {
+	hashes *contentHashCache
+}
+
+// NewETagCache returns an ETagCache remembering up to maxEntries ETags.
+func NewETagCache(maxEntries int) *ETagCache {
+	return &ETagCache{newContentHashCache(maxEntries)}
+}
+
+// ETag returns the ETag of the file with the given name and info, reading
+// content if required. The read position of content is reset afterwards.
+func (c *ETagCache) ETag(name string, fi os.FileInfo, content io.ReadSeeker) (string, error) {
+	sum, err := c.hashes.sum(name, fi, content, "sha-256", sha256.New)
+	if err != nil {
+		return "", err
+	}
+	return hashETag(sum), nil
+}
+
+// contentETag returns a strong ETag for data.
+func contentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hashETag(sum[:])
+}
+
+func hashETag(sum []byte) string {
+	return "\"" + hex.EncodeToString(sum[:16]) + "\""
+}
+
+type contentHashKey struct {
+	name      string
+	size      int64
+	modTime   int64
+	algorithm string
+}
+
+// contentHashCache remembers hashes of file contents by path, size and
+// modification time.
+type contentHashCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	sums       map[contentHashKey][]byte
+}
+
+func newContentHashCache(maxEntries int) *contentHashCache {
+	return &contentHashCache{
+		maxEntries: maxEntries,
+		sums:       make(map[contentHashKey][]byte),
+	}
+}
+
+func (c *contentHashCache) sum(name string, fi os.FileInfo, content io.ReadSeeker, algorithm string, newHash func() hash.Hash) ([]byte, error) {
+	key := contentHashKey{name, fi.Size(), fi.ModTime().UnixNano(), algorithm}
+	c.mutex.Lock()
+	sum, ok := c.sums[key]
+	c.mutex.Unlock()
+	if ok {
+		return sum, nil
+	}
+
+	h := newHash()
+	if _, err := io.Copy(h, content); err != nil {
+		return nil, err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	sum = h.Sum(nil)
+
+	c.mutex.Lock()
+	if len(c.sums) >= c.maxEntries {
+		// Make room by dropping any entry, outdated ones are never used
+		// again anyway.
+		for k := range c.sums {
+			delete(c.sums, k)
+			break
+		}
+	}
+	c.sums[key] = sum
+	c.mutex.Unlock()
+	return sum, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeFileWithOptions_ContentETags(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "data.txt")
+	modTime := time.Date(2014, 6, 1, 12, 0, 0, 0, time.UTC)
+	options := &FileOptions{ETags: NewETagCache(10)}
+
+	serve := func(header, value string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/data.txt", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		FileStaticServerWithOptions(http.Dir(dir), options).ServeHTTP(w, r)
+		return w
+	}
+
+	ioutil.WriteFile(name, []byte("first version"), 0644)
+	os.Chtimes(name, modTime, modTime)
+	etag := serve("", "").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag to be set")
+	}
+	if w := serve("If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("Expected matching If-None-Match to return %d, but was %d", http.StatusNotModified, w.Code)
+	}
+
+	// Same size and modification time, but different content.
+	ioutil.WriteFile(name, []byte("other version"), 0644)
+	os.Chtimes(name, modTime, modTime)
+	w := serve("If-None-Match", etag)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected cached ETag for unchanged size and modification time, but got %d", w.Code)
+	}
+	options.ETags = NewETagCache(10)
+	w = serve("If-None-Match", etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("Expected new ETag for changed content, but got %d with %s", w.Code, w.Header().Get("ETag"))
+	}
+
+	r, _ := http.NewRequest("GET", "/data.txt", nil)
+	r.Header.Set("Range", "bytes=0-4")
+	r.Header.Set("If-Range", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	FileStaticServerWithOptions(http.Dir(dir), options).ServeHTTP(w, r)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "other" {
+		t.Errorf("Expected If-Range with current ETag to return partial content, but got %d '%s'", w.Code, w.Body.String())
+	}
+}
+
+func TestMakeGzipHandler_ContentETags(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Repeat("compressible content ", 50)
+	ioutil.WriteFile(filepath.Join(dir, "data.txt"), []byte(content), 0644)
+	handler := FileStaticServerWithOptions(http.Dir(dir), &FileOptions{ETags: NewETagCache(10)})
+
+	serve := func(headers ...string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/data.txt", nil)
+		for i := 0; i < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	identity := serve().Header().Get("ETag")
+	w := serve("Accept-Encoding", "gzip")
+	compressed := w.Header().Get("ETag")
+	if w.Header().Get("Content-Encoding") != "gzip" || compressed == identity || !strings.HasSuffix(compressed, `-gzip"`) {
+		t.Fatalf("Expected gzip ETag different from %s, but was %s", identity, compressed)
+	}
+	if w.Header().Get("Accept-Ranges") != "" {
+		t.Errorf("Expected no Accept-Ranges for compressed response, but was %s", w.Header().Get("Accept-Ranges"))
+	}
+
+	w = serve("Accept-Encoding", "gzip", "If-None-Match", compressed)
+	if w.Code != http.StatusNotModified || w.Header().Get("ETag") != compressed {
+		t.Errorf("Expected %d with ETag %s, but got %d with %s", http.StatusNotModified, compressed, w.Code, w.Header().Get("ETag"))
+	}
+	if w = serve("If-None-Match", compressed); w.Code != http.StatusOK {
+		t.Errorf("Expected gzip ETag not to match identity representation, but got %d", w.Code)
+	}
+
+	w = serve("Accept-Encoding", "gzip", "Range", "bytes=0-10")
+	if w.Code != http.StatusPartialContent || w.Header().Get("Content-Encoding") != "" || w.Body.String() != content[:11] {
+		t.Errorf("Expected identity range, but got %d with encoding '%s'", w.Code, w.Header().Get("Content-Encoding"))
+	}
+	if contentRange := w.Header().Get("Content-Range"); contentRange != fmt.Sprintf("bytes 0-10/%d", len(content)) {
+		t.Errorf("Unexpected Content-Range %s", contentRange)
+	}
+	if w.Header().Get("ETag") != identity {
+		t.Errorf("Expected identity ETag %s for range, but was %s", identity, w.Header().Get("ETag"))
+	}
+}
@@ -5,36 +5,166 @@
 package httputils
 
 import (
+	"io"
+	"mime"
 	"net/http"
 	"os"
+	"path/filepath"
 )
 
+// etagFile is implemented by files which know a strong ETag for their
+// contents, see CachedFileSystem.
+type etagFile interface {
+	etag() string
+}
+
+// encodedFile is implemented by files which have their contents available
+// in a content coding such as gzip without compressing them on the fly.
+type encodedFile interface {
+	encodedContent(encoding string) io.ReadSeeker
+}
+
+// FileOptions configures optional behaviour of ServeFileWithOptions and
+// the file servers of this package.
+type FileOptions struct {
+	// ETags, when set, provides strong ETags computed from the file
+	// contents, so that conditional requests work reliably even when
+	// modification times are not.
+	ETags *ETagCache
+
+	// Deny, when set, is called with the cleaned path and info of every
+	// file before it is served. Returning true refuses access to it.
+	Deny func(path string, fi os.FileInfo) bool
+
+	// Digests, when set, provides integrity digests of the files.
+	Digests *DigestCache
+
+	// Throttle, when set, limits the bandwidth used for sending files. It
+	// applies to the bytes written to the http.ResponseWriter passed to
+	// ServeFileWithOptions, which are uncompressed if a handler like
+	// MakeGzipHandler compresses them afterwards. FileStaticServerWithOptions
+	// throttles the compressed bytes instead.
+	Throttle *Throttle
+
+	// ProblemDetails enables sending errors as problem details objects
+	// (RFC 9457) instead of plain text.
+	ProblemDetails bool
+}
+
 // ServeFile responds to w with the contents of path within fs.
 func ServeFile(w http.ResponseWriter, r *http.Request, fs http.FileSystem, path string) {
+	ServeFileWithOptions(w, r, fs, path, nil)
+}
+
+// ServeFileWithOptions responds to w with the contents of path within fs,
+// as configured by options, which may be nil.
+func ServeFileWithOptions(w http.ResponseWriter, r *http.Request, fs http.FileSystem, path string, options *FileOptions) {
+	serveFile(w, r, fs, path, options, nil)
+}
+
+// serveFile implements ServeFileWithOptions, passing directories to
+// serveDir instead of refusing them if it is not nil. The returned error is
+// that of serveDir.
+func serveFile(w http.ResponseWriter, r *http.Request, fs http.FileSystem, path string, options *FileOptions, serveDir func(fileinfo os.FileInfo) error) error {
+	if options == nil {
+		options = &FileOptions{}
+	}
 
 	// Open file handle.
 	f, err := fs.Open(path)
 	if err != nil {
-		http.Error(w, "404 Not Found", 404)
-		return
+		httpError(w, r, http.StatusNotFound, options.ProblemDetails)
+		return nil
 	}
 	defer f.Close()
 
 	// Make sure path exists.
 	fileinfo, err1 := f.Stat()
 	if err1 != nil {
-		http.Error(w, "404 Not Found", 404)
-		return
+		httpError(w, r, http.StatusNotFound, options.ProblemDetails)
+		return nil
 	}
 
 	// Reject directory requests.
 	if fileinfo.IsDir() {
-		http.Error(w, "403 Forbidden", 403)
-		return
+		if serveDir != nil {
+			return serveDir(fileinfo)
+		}
+		httpError(w, r, http.StatusForbidden, options.ProblemDetails)
+		return nil
+	}
+
+	if options.Deny != nil && options.Deny(path, fileinfo) {
+		httpError(w, r, http.StatusForbidden, options.ProblemDetails)
+		return nil
 	}
 
-	http.ServeContent(w, r, fileinfo.Name(), fileinfo.ModTime(), f)
+	var content io.ReadSeeker = f
+	encoding := ""
+	if ef, ok := f.(encodedFile); ok {
+		h := w.Header()
+		addVary(h, "Accept-Encoding")
+		for _, accepted := range acceptedEncodings(r) {
+			if rs := ef.encodedContent(accepted); rs != nil {
+				if h.Get("Content-Type") == "" {
+					h.Set("Content-Type", detectContentType(fileinfo.Name(), f))
+				}
+				h.Set("Content-Encoding", accepted)
+				content, encoding = rs, accepted
+				break
+			}
+		}
+	}
 
+	if w.Header().Get("ETag") == "" {
+		etag := ""
+		if tf, ok := f.(etagFile); ok {
+			etag = tf.etag()
+		}
+		if etag == "" && options.ETags != nil {
+			if etag, err = options.ETags.ETag(path, fileinfo, f); err != nil {
+				httpError(w, r, http.StatusInternalServerError, options.ProblemDetails)
+				return nil
+			}
+		}
+		if etag != "" {
+			if encoding != "" {
+				// Each representation needs its own strong ETag.
+				etag = encodedETag(etag, encoding)
+			}
+			w.Header().Set("ETag", etag)
+		}
+	}
+
+	if options.Digests != nil {
+		digestName := path
+		if encoding != "" {
+			digestName += "\x00" + encoding
+		}
+		if err := options.Digests.SetDigestHeaders(w, r, digestName, fileinfo, content); err != nil {
+			httpError(w, r, http.StatusInternalServerError, options.ProblemDetails)
+			return nil
+		}
+	}
+
+	if options.Throttle != nil {
+		w = options.Throttle.Wrap(w, r)
+	}
+	http.ServeContent(w, r, fileinfo.Name(), fileinfo.ModTime(), content)
+	return nil
+
+}
+
+// detectContentType returns the media type of content like
+// http.ServeContent would determine it.
+func detectContentType(name string, content io.ReadSeeker) string {
+	if ctype := mime.TypeByExtension(filepath.Ext(name)); ctype != "" {
+		return ctype
+	}
+	var buf [512]byte
+	n, _ := io.ReadFull(content, buf[:])
+	content.Seek(0, io.SeekStart)
+	return http.DetectContentType(buf[:n])
 }
 
 // HasFilePath returns true if path is openable and stat-able, otherwise false.
@@ -9,55 +9,219 @@ import (
 	"compress/zlib"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
 type gzipResponseWriter struct {
-	io.Writer
 	http.ResponseWriter
+	encoding    string
+	head        bool
+	writer      io.WriteCloser
+	wroteHeader bool
+	passThrough bool
+	logEntry    *AccessLogEntry
 }
 
-func (w gzipResponseWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	switch {
+	case h.Get("Content-Encoding") != "" || code == http.StatusPartialContent:
+		// Already encoded by the handler, or a range of the identity
+		// representation, which Content-Range refers to.
+		w.passThrough = true
+	case code == http.StatusNoContent || code == http.StatusNotModified:
+		// No body at all, but the ETag names the compressed
+		// representation the client holds.
+		w.passThrough = true
+		if etag := h.Get("ETag"); etag != "" {
+			h.Set("ETag", encodedETag(etag, w.encoding))
+		}
+	default:
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		// Ranges, ETags and digests of the original content no longer
+		// apply.
+		h.Del("Accept-Ranges")
+		if etag := h.Get("ETag"); etag != "" {
+			h.Set("ETag", encodedETag(etag, w.encoding))
+		}
+		h.Del("Digest")
+		h.Del("Repr-Digest")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			// Sniff before compression, the server would see gzip data.
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passThrough {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.writer == nil {
+		if err := w.startCompression(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.writer.Write(b)
+	if w.logEntry != nil {
+		w.logEntry.compressed = true
+		w.logEntry.UncompressedBytes += int64(n)
+	}
+	return n, err
+}
+
+func (w *gzipResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.writer != nil {
+		if flusher, ok := w.writer.(interface{ Flush() error }); ok {
+			flusher.Flush()
+		}
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *gzipResponseWriter) startCompression() (err error) {
+	switch w.encoding {
+	case "gzip":
+		w.writer, err = gzip.NewWriterLevel(w.ResponseWriter, gzip.BestSpeed)
+	case "deflate":
+		w.writer, err = zlib.NewWriterLevel(w.ResponseWriter, zlib.BestSpeed)
+	}
+	return
+}
+
+func (w *gzipResponseWriter) close() error {
+	if !w.wroteHeader || w.passThrough {
+		return nil
+	}
+	if w.writer == nil {
+		if w.head {
+			return nil
+		}
+		// Even an empty body needs to be a valid stream.
+		if err := w.startCompression(); err != nil {
+			return err
+		}
+	}
+	return w.writer.Close()
 }
 
 // MakeGzipHandler wraps handler such that its output will be compressed
 // according to what the client supports.
+//
+// Responses for which handler sets a Content-Encoding itself, for example
+// when ServeFile sends precompressed content, are passed through as is, as
+// are partial responses. ETags of compressed responses get the content
+// coding appended, so that they differ from the identity representation,
+// and are understood in If-None-Match.
 func MakeGzipHandler(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		encodings := strings.Split(r.Header.Get("Accept-Encoding"), ",")
-		var w_compressed io.WriteCloser
-		var err error
-		for _, encoding := range encodings {
-			encoding = strings.TrimSpace(encoding)
-			switch encoding {
-			case "gzip":
-				w_compressed, err = gzip.NewWriterLevel(w, gzip.BestSpeed)
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				defer w_compressed.Close()
-				w.Header().Set("Content-Encoding", "gzip")
-			case "deflate":
-				w_compressed, err = zlib.NewWriterLevel(w, zlib.BestSpeed)
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				defer w_compressed.Close()
-				w.Header().Set("Content-Encoding", "deflate")
-			}
-			if w_compressed != nil {
+		var encoding string
+		for _, accepted := range acceptedEncodings(r) {
+			if accepted == "gzip" || accepted == "deflate" {
+				encoding = accepted
 				break
 			}
 		}
-		if w_compressed == nil {
+		if encoding == "" {
 			handler(w, r)
 			return
 		}
-		w.Header().Set("Vary", "Accept-Encoding")
-		handler(gzipResponseWriter{Writer: w_compressed, ResponseWriter: w}, r)
+		addVary(w.Header(), "Accept-Encoding")
+		if value := r.Header.Get("If-None-Match"); value != "" {
+			if decoded := decodedETags(value, encoding); decoded != value {
+				r2 := new(http.Request)
+				*r2 = *r
+				r2.Header = r.Header.Clone()
+				r2.Header.Set("If-None-Match", decoded)
+				r = r2
+			}
+		}
+		gw := &gzipResponseWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			head:           r.Method == "HEAD",
+			logEntry:       accessLogEntry(r),
+		}
+		defer gw.close()
+		handler(gw, r)
+	}
+}
+
+// encodedETag returns etag marked as belonging to the representation with
+// the given content coding, unless it already is.
+func encodedETag(etag, encoding string) string {
+	if len(etag) < 2 || !strings.HasSuffix(etag, "\"") || strings.HasSuffix(etag, "-"+encoding+"\"") {
+		return etag
+	}
+	return etag[:len(etag)-1] + "-" + encoding + "\""
+}
+
+// decodedETags adds the entity tags of the If-None-Match value which were
+// marked by encodedETag with encoding to value without that mark, so that
+// handlers unaware of the compression match them too.
+func decodedETags(value, encoding string) string {
+	suffix := "-" + encoding + "\""
+	decoded := value
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if len(tag) > len(suffix) && strings.HasSuffix(tag, suffix) {
+			decoded += ", " + tag[:len(tag)-len(suffix)] + "\""
+		}
+	}
+	return decoded
+}
+
+// acceptedEncodings returns the content codings listed in the
+// Accept-Encoding header of r in the order given by the client, leaving
+// out those explicitly refused with q=0.
+func acceptedEncodings(r *http.Request) []string {
+	var encodings []string
+	for _, raw := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(raw, ";")
+		encoding := strings.ToLower(strings.TrimSpace(parts[0]))
+		if encoding == "" {
+			continue
+		}
+		refused := false
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				refused = err == nil && q == 0
+			}
+		}
+		if !refused {
+			encodings = append(encodings, encoding)
+		}
+	}
+	return encodings
+}
 
+// addVary adds field to the Vary header of h unless it is already present.
+func addVary(h http.Header, field string) {
+	for _, value := range h["Vary"] {
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSpace(v)
+			if v == "*" || strings.EqualFold(v, field) {
+				return
+			}
+		}
 	}
+	h.Add("Vary", field)
 }
@@ -0,0 +1,253 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The conventional paths at which the handlers returned by
+// HealthRegistry.LivenessHandler and HealthRegistry.ReadinessHandler should
+// be mounted.
+const (
+	HealthzPath = "/healthz"
+	ReadyzPath  = "/readyz"
+)
+
+// Health states reported by a HealthRegistry.
+const (
+	HealthOK        = "ok"
+	HealthDegraded  = "degraded"
+	HealthUnhealthy = "unhealthy"
+)
+
+// HealthCheck checks a component, returning an error if it is unhealthy.
+// It should give up once ctx is done.
+type HealthCheck func(ctx context.Context) error
+
+// HealthCheckOptions configures a check registered with a HealthRegistry.
+type HealthCheckOptions struct {
+	// Timeout after which the check is considered failed, five seconds
+	// if zero.
+	Timeout time.Duration
+
+	// Interval during which the last result is reused instead of running
+	// the check again, the MinInterval of the registry if zero.
+	Interval time.Duration
+
+	// Critical checks make the overall state unhealthy when failing,
+	// others only degraded.
+	Critical bool
+
+	// Liveness includes the check in liveness reports, which should
+	// only be done for checks detecting states requiring a restart. All
+	// checks are part of readiness reports.
+	Liveness bool
+}
+
+// HealthCheckResult is the outcome of a single check.
+type HealthCheckResult struct {
+	Status   string        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Critical bool          `json:"critical"`
+	Latency  time.Duration `json:"-"`
+	// LatencyMs is Latency in milliseconds.
+	LatencyMs float64   `json:"latency_ms"`
+	Checked   time.Time `json:"checked"`
+}
+
+// HealthReport is the aggregated outcome of the checks of a
+// HealthRegistry.
+type HealthReport struct {
+	Status   string                        `json:"status"`
+	Draining bool                          `json:"draining,omitempty"`
+	Checks   map[string]*HealthCheckResult `json:"checks"`
+}
+
+type healthCheckEntry struct {
+	name    string
+	check   HealthCheck
+	options HealthCheckOptions
+	mutex   sync.Mutex
+	result  *HealthCheckResult
+}
+
+// HealthRegistry runs the health checks registered by the components of
+// an application and reports their aggregated results. Checks run
+// concurrently and their results are cached for a minimum interval.
+type HealthRegistry struct {
+	// MinInterval is the default interval during which results of checks
+	// are reused, one second if zero.
+	MinInterval time.Duration
+
+	mutex   sync.Mutex
+	checks  []*healthCheckEntry
+	servers []*Server
+}
+
+// NewHealthRegistry returns an empty HealthRegistry.
+func NewHealthRegistry() *HealthRegistry {
+	return &HealthRegistry{}
+}
+
+// Register adds check with the given name, replacing any check registered
+// with the same name before.
+func (h *HealthRegistry) Register(name string, check HealthCheck, options HealthCheckOptions) {
+	if options.Timeout <= 0 {
+		options.Timeout = 5 * time.Second
+	}
+	entry := &healthCheckEntry{name: name, check: check, options: options}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i, existing := range h.checks {
+		if existing.name == name {
+			h.checks[i] = entry
+			return
+		}
+	}
+	h.checks = append(h.checks, entry)
+}
+
+// WatchServer makes readiness reports unhealthy while srv is draining.
+func (h *HealthRegistry) WatchServer(srv *Server) {
+	h.mutex.Lock()
+	h.servers = append(h.servers, srv)
+	h.mutex.Unlock()
+}
+
+// Check runs the checks for a liveness or readiness report.
+func (h *HealthRegistry) Check(ctx context.Context, readiness bool) *HealthReport {
+	h.mutex.Lock()
+	checks := make([]*healthCheckEntry, 0, len(h.checks))
+	for _, entry := range h.checks {
+		if readiness || entry.options.Liveness {
+			checks = append(checks, entry)
+		}
+	}
+	draining := false
+	if readiness {
+		for _, srv := range h.servers {
+			draining = draining || srv.Draining()
+		}
+	}
+	minInterval := h.MinInterval
+	h.mutex.Unlock()
+	if minInterval <= 0 {
+		minInterval = time.Second
+	}
+
+	results := make([]*HealthCheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, entry := range checks {
+		wg.Add(1)
+		go func(i int, entry *healthCheckEntry) {
+			defer wg.Done()
+			results[i] = entry.run(ctx, minInterval)
+		}(i, entry)
+	}
+	wg.Wait()
+
+	report := &HealthReport{
+		Status:   HealthOK,
+		Draining: draining,
+		Checks:   make(map[string]*HealthCheckResult, len(checks)),
+	}
+	for i, entry := range checks {
+		result := results[i]
+		report.Checks[entry.name] = result
+		if result.Status != HealthOK {
+			if result.Critical {
+				report.Status = HealthUnhealthy
+			} else if report.Status == HealthOK {
+				report.Status = HealthDegraded
+			}
+		}
+	}
+	if draining {
+		report.Status = HealthUnhealthy
+	}
+	return report
+}
+
+// run returns the cached result of the check, or runs it if that is older
+// than the check interval. Concurrent callers wait for a single run.
+func (entry *healthCheckEntry) run(ctx context.Context, minInterval time.Duration) *HealthCheckResult {
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+	interval := entry.options.Interval
+	if interval <= 0 {
+		interval = minInterval
+	}
+	if entry.result != nil && time.Since(entry.result.Checked) < interval {
+		return entry.result
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, entry.options.Timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- entry.check(checkCtx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-checkCtx.Done():
+		// The check ignores its context, leave it behind.
+		err = errors.New("timeout")
+	}
+
+	latency := time.Since(start)
+	result := &HealthCheckResult{
+		Status:    HealthOK,
+		Critical:  entry.options.Critical,
+		Latency:   latency,
+		LatencyMs: float64(latency) / float64(time.Millisecond),
+		Checked:   start,
+	}
+	if err != nil {
+		result.Status = HealthUnhealthy
+		result.Error = err.Error()
+	}
+	// Results of canceled requests must not be reused, unlike timeouts.
+	if ctx.Err() == nil {
+		entry.result = result
+	}
+	return result
+}
+
+// LivenessHandler returns a handler responding with the report of the
+// liveness checks as JSON, with status 503 Service Unavailable if it is
+// unhealthy and 200 OK otherwise.
+func (h *HealthRegistry) LivenessHandler() http.HandlerFunc {
+	return h.handler(false)
+}
+
+// ReadinessHandler returns a handler like LivenessHandler reporting on all
+// checks, which also fails while a watched Server is draining.
+func (h *HealthRegistry) ReadinessHandler() http.HandlerFunc {
+	return h.handler(true)
+}
+
+func (h *HealthRegistry) handler(readiness bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := h.Check(r.Context(), readiness)
+		status := http.StatusOK
+		if report.Status == HealthUnhealthy {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		if r.Method != "HEAD" {
+			json.NewEncoder(w).Encode(report)
+		}
+	}
+}
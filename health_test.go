@@ -0,0 +1,114 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func checkHealth(t *testing.T, handler http.HandlerFunc, expectedStatus int) *HealthReport {
+	r, _ := http.NewRequest("GET", ReadyzPath, nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != expectedStatus {
+		t.Errorf("Expected response status to be %d, but was %d", expectedStatus, w.Code)
+	}
+	report := &HealthReport{}
+	if err := json.Unmarshal(w.Body.Bytes(), report); err != nil {
+		t.Fatalf("Failed to unmarshall json: %v", err)
+	}
+	return report
+}
+
+func TestHealthRegistryAggregatesChecks(t *testing.T) {
+	health := NewHealthRegistry()
+	health.Register("db", func(ctx context.Context) error { return nil }, HealthCheckOptions{Critical: true, Liveness: true})
+	health.Register("cache", func(ctx context.Context) error { return errors.New("down") }, HealthCheckOptions{})
+
+	report := checkHealth(t, health.ReadinessHandler(), http.StatusOK)
+	if report.Status != HealthDegraded {
+		t.Errorf("Expected status %s, but was %s", HealthDegraded, report.Status)
+	}
+	if result := report.Checks["cache"]; result == nil || result.Error != "down" {
+		t.Errorf("Expected failing cache check, but was %+v", result)
+	}
+
+	report = checkHealth(t, health.LivenessHandler(), http.StatusOK)
+	if len(report.Checks) != 1 || report.Status != HealthOK {
+		t.Errorf("Expected only the healthy liveness check, but was %+v", report)
+	}
+
+	health.Register("db", func(ctx context.Context) error { return errors.New("gone") }, HealthCheckOptions{Critical: true})
+	report = checkHealth(t, health.ReadinessHandler(), http.StatusServiceUnavailable)
+	if report.Status != HealthUnhealthy {
+		t.Errorf("Expected status %s, but was %s", HealthUnhealthy, report.Status)
+	}
+}
+
+func TestHealthRegistryCachesResults(t *testing.T) {
+	var runs int32
+	health := NewHealthRegistry()
+	health.Register("counter", func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}, HealthCheckOptions{Interval: time.Hour})
+
+	for i := 0; i < 3; i++ {
+		health.Check(context.Background(), true)
+	}
+	if runs != 1 {
+		t.Errorf("Expected check to run once, but ran %d times", runs)
+	}
+}
+
+func TestHealthRegistryTimeout(t *testing.T) {
+	var runs int32
+	health := NewHealthRegistry()
+	health.Register("slow", func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		time.Sleep(time.Second)
+		return nil
+	}, HealthCheckOptions{Timeout: 10 * time.Millisecond, Interval: time.Hour, Critical: true})
+
+	for i := 0; i < 3; i++ {
+		report := health.Check(context.Background(), true)
+		if result := report.Checks["slow"]; result.Status != HealthUnhealthy || result.Error != "timeout" {
+			t.Errorf("Expected check to time out, but was %+v", result)
+		}
+	}
+	if runs := atomic.LoadInt32(&runs); runs != 1 {
+		t.Errorf("Expected timed out result to be cached, but check ran %d times", runs)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	health.Register("canceled", func(ctx context.Context) error {
+		return ctx.Err()
+	}, HealthCheckOptions{Interval: time.Hour})
+	health.Check(ctx, true)
+	if report := health.Check(context.Background(), true); report.Checks["canceled"].Status != HealthOK {
+		t.Errorf("Expected result of canceled request not to be cached, but was %+v", report.Checks["canceled"])
+	}
+}
+
+func TestHealthRegistryDrainingServer(t *testing.T) {
+	srv := &Server{}
+	health := NewHealthRegistry()
+	health.WatchServer(srv)
+
+	checkHealth(t, health.ReadinessHandler(), http.StatusOK)
+	atomic.StoreInt32(&srv.draining, 1)
+	if report := checkHealth(t, health.ReadinessHandler(), http.StatusServiceUnavailable); !report.Draining {
+		t.Error("Expected report to show draining server")
+	}
+	checkHealth(t, health.LivenessHandler(), http.StatusOK)
+}
@@ -0,0 +1,125 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// JournalSocket is the path of the socket of the native journald protocol.
+const JournalSocket = "/run/systemd/journal/socket"
+
+// JournalWriter sends entries to journald using its native protocol, with
+// the attributes of slog records as structured fields. It writes entries
+// as text lines to a fallback writer when journald is not available.
+//
+// A JournalWriter is an io.Writer sending every write as an entry at info
+// level, so it can back a log.Logger or an AccessLogger.
+type JournalWriter struct {
+	// Identifier is sent as SYSLOG_IDENTIFIER, the name of the executable
+	// if empty.
+	Identifier string
+
+	sink datagramSink
+}
+
+// NewJournalWriter returns a JournalWriter sending to the socket at path,
+// or JournalSocket if empty. Entries which cannot be sent are written to
+// fallback, or os.Stderr if nil.
+func NewJournalWriter(path string, fallback io.Writer) *JournalWriter {
+	if path == "" {
+		path = JournalSocket
+	}
+	return &JournalWriter{sink: datagramSink{path: path, fallback: fallback}}
+}
+
+// Handler returns a slog.Handler logging to j, which can back a Logger
+// created with NewLogger.
+func (j *JournalWriter) Handler(opts *slog.HandlerOptions) slog.Handler {
+	return newSinkHandler(j.send, opts)
+}
+
+func (j *JournalWriter) Write(b []byte) (int, error) {
+	if err := j.send(writeRecord(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the connection to journald.
+func (j *JournalWriter) Close() error {
+	return j.sink.close()
+}
+
+func (j *JournalWriter) send(record *sinkRecord) error {
+	identifier := j.Identifier
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+
+	var buf bytes.Buffer
+	appendJournalField(&buf, "MESSAGE", record.Message)
+	appendJournalField(&buf, "PRIORITY", strconv.Itoa(severity(record.Level)))
+	appendJournalField(&buf, "SYSLOG_IDENTIFIER", identifier)
+	for _, field := range record.Fields {
+		if name := journalFieldName(field.Path); name != "" {
+			appendJournalField(&buf, name, field.Value)
+		}
+	}
+
+	return j.sink.send(func(conn *net.UnixConn) error {
+		_, err := conn.Write(buf.Bytes())
+		if err != nil && isMessageTooLarge(err) {
+			// Pass entries too large for a datagram as file.
+			return sendJournalFile(conn, buf.Bytes())
+		}
+		return err
+	}, record)
+}
+
+// appendJournalField appends a field serialized in the native journald
+// protocol to buf.
+func appendJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+	} else {
+		buf.WriteByte('\n')
+		var size [8]byte
+		binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+		buf.Write(size[:])
+		buf.WriteString(value)
+	}
+	buf.WriteByte('\n')
+}
+
+// journalFieldName returns a valid journal field name for path, which
+// consists of uppercase letters, digits and underscores, does not start
+// with an underscore or a digit and is at most 64 characters long.
+func journalFieldName(path []string) string {
+	name := []byte(strings.ToUpper(strings.Join(path, "_")))
+	for i, c := range name {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			name[i] = '_'
+		}
+	}
+	result := strings.TrimLeft(string(name), "_")
+	if result != "" && result[0] >= '0' && result[0] <= '9' {
+		result = "F_" + result
+	}
+	if len(result) > 64 {
+		result = result[:64]
+	}
+	return result
+}
@@ -0,0 +1,21 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package httputils
+
+import (
+	"errors"
+	"net"
+)
+
+func isMessageTooLarge(err error) bool {
+	return false
+}
+
+func sendJournalFile(conn *net.UnixConn, data []byte) error {
+	return errors.New("passing files is not supported")
+}
@@ -0,0 +1,143 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LanguageRange is a language range with its q-value from an
+// Accept-Language header, such as "de-AT" or "*".
+type LanguageRange struct {
+	Tag string
+	Q   float64
+}
+
+// AcceptedLanguages returns the language ranges from the Accept-Language
+// header of r, ordered by decreasing q-value. Tags are lower cased.
+func AcceptedLanguages(r *http.Request) []LanguageRange {
+	var ranges []LanguageRange
+	for _, value := range r.Header[http.CanonicalHeaderKey("Accept-Language")] {
+		for _, raw := range strings.Split(value, ",") {
+			parts := strings.Split(raw, ";")
+			tag := strings.ToLower(strings.TrimSpace(parts[0]))
+			if tag == "" {
+				continue
+			}
+			q := 1.0
+			for _, param := range parts[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					var err error
+					if q, err = strconv.ParseFloat(param[2:], 64); err != nil || q < 0 || q > 1 {
+						q = -1
+					}
+				}
+			}
+			if q >= 0 {
+				ranges = append(ranges, LanguageRange{tag, q})
+			}
+		}
+	}
+	sort.Stable(byLanguageQuality(ranges))
+	return ranges
+}
+
+// NegotiateLanguage returns the language out of supported which suits r
+// best according to its Accept-Language header, or defaultLanguage if
+// none of them is acceptable.
+//
+// Ranges are tried in order of their q-value. For each range, a supported
+// language equal to it is selected, otherwise the first one matching it by
+// basic filtering (RFC 4647 section 3.3.1), so "de" selects "de-AT" unless
+// "de" is supported as well. Failing that, the range is
+// shortened as in lookup (RFC 4647 section 3.4), so "de-AT" selects "de".
+// Languages matched by a range with q=0 are never selected.
+func NegotiateLanguage(r *http.Request, defaultLanguage string, supported ...string) string {
+	ranges := AcceptedLanguages(r)
+	excluded := func(language string) bool {
+		for _, lr := range ranges {
+			if lr.Q == 0 && lr.Tag != "*" && languageMatches(lr.Tag, language) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, lr := range ranges {
+		if lr.Q == 0 {
+			break
+		}
+		for _, language := range supported {
+			if strings.EqualFold(lr.Tag, language) && !excluded(language) {
+				return language
+			}
+		}
+		for _, language := range supported {
+			if languageMatches(lr.Tag, language) && !excluded(language) {
+				return language
+			}
+		}
+		for tag := lr.Tag; ; {
+			i := strings.LastIndex(tag, "-")
+			if i < 0 {
+				break
+			}
+			if tag = strings.TrimSuffix(tag[:i], "-x"); tag == "" {
+				break
+			}
+			for _, language := range supported {
+				if strings.EqualFold(tag, language) && !excluded(language) {
+					return language
+				}
+			}
+		}
+	}
+	return defaultLanguage
+}
+
+// languageMatches returns true if the language range matches language by
+// basic filtering.
+func languageMatches(tag, language string) bool {
+	if tag == "*" {
+		return true
+	}
+	language = strings.ToLower(language)
+	return language == tag || strings.HasPrefix(language, tag+"-")
+}
+
+type languageContextKey struct{}
+
+// MakeLanguageHandler wraps handler such that the language selected by
+// NegotiateLanguage is available to it through RequestLanguage. The
+// language is sent in the Content-Language header, unless handler sets
+// another one.
+func MakeLanguageHandler(handler http.HandlerFunc, defaultLanguage string, supported ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		language := NegotiateLanguage(r, defaultLanguage, supported...)
+		addVary(w.Header(), "Accept-Language")
+		if language != "" {
+			w.Header().Set("Content-Language", language)
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), languageContextKey{}, language)))
+	}
+}
+
+// RequestLanguage returns the language selected for r by the handler
+// returned by MakeLanguageHandler, or an empty string.
+func RequestLanguage(r *http.Request) string {
+	language, _ := r.Context().Value(languageContextKey{}).(string)
+	return language
+}
+
+type byLanguageQuality []LanguageRange
+
+func (s byLanguageQuality) Len() int           { return len(s) }
+func (s byLanguageQuality) Less(i, j int) bool { return s[i].Q > s[j].Q }
+func (s byLanguageQuality) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
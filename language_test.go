@@ -0,0 +1,60 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateLanguage(t *testing.T) {
+	supported := []string{"en", "de-AT", "de", "fr-CA", "zh-Hant"}
+	for acceptLanguage, expected := range map[string]string{
+		"":                           "en",
+		"de":                         "de",
+		"de-AT, en;q=0.8":            "de-AT",
+		"DE-at":                      "de-AT",
+		"de-CH":                      "de",
+		"fr":                         "fr-CA",
+		"it, fr-CA;q=0.5":            "fr-CA",
+		"it":                         "en",
+		"zh-Hant-TW":                 "zh-Hant",
+		"*":                          "en",
+		"*, en;q=0":                  "de-AT",
+		"de;q=0.5, en;q=0.9":         "en",
+		"de-CH-x-private, en;q=0.1":  "de",
+		"es, de;q=invalid, fr;q=0.2": "fr-CA",
+	} {
+		r, _ := http.NewRequest("", "", nil)
+		if acceptLanguage != "" {
+			r.Header.Set("Accept-Language", acceptLanguage)
+		}
+		if actual := NegotiateLanguage(r, "en", supported...); actual != expected {
+			t.Errorf("Expected %s to be selected for '%s', but was %s", expected, acceptLanguage, actual)
+		}
+	}
+}
+
+func TestMakeLanguageHandler(t *testing.T) {
+	var selected string
+	handler := MakeLanguageHandler(func(w http.ResponseWriter, r *http.Request) {
+		selected = RequestLanguage(r)
+	}, "en", "en", "de")
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "de-DE,de;q=0.9,en;q=0.8")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if selected != "de" {
+		t.Errorf("Expected de to be stored in the request context, but was '%s'", selected)
+	}
+	if language := w.Header().Get("Content-Language"); language != "de" {
+		t.Errorf("Expected Content-Language to be de, but was '%s'", language)
+	}
+	if vary := w.Header().Get("Vary"); vary != "Accept-Language" {
+		t.Errorf("Expected Vary to be Accept-Language, but was '%s'", vary)
+	}
+}
@@ -5,25 +5,119 @@
 package httputils
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
+	"sync"
 )
 
-// LogErrorf logs its arguments to the standard logger, and
-// sets the exit status of ExitWithStatus to 1.
+// Logger is a leveled logger with structured fields. Arguments following
+// the message are key-value pairs as understood by log/slog, for example
+//
+//	logger.Warn("slow request", "path", r.URL.Path, "duration", d)
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+
+	// With returns a Logger adding args to every record.
+	With(args ...interface{}) Logger
+}
+
+type slogLogger struct {
+	*slog.Logger
+}
+
+// NewLogger returns a Logger writing records to handler. A nil handler
+// uses the handler of slog.Default.
+func NewLogger(handler slog.Handler) Logger {
+	if handler == nil {
+		return SlogLogger(slog.Default())
+	}
+	return SlogLogger(slog.New(handler))
+}
+
+// SlogLogger returns a Logger backed by l.
+func SlogLogger(l *slog.Logger) Logger {
+	return &slogLogger{l}
+}
+
+func (l *slogLogger) With(args ...interface{}) Logger {
+	return &slogLogger{l.Logger.With(args...)}
+}
+
+var (
+	packageLogger      Logger
+	packageLoggerMutex sync.RWMutex
+)
+
+// SetLogger sets the Logger used by LogErrorf, LogFatalf and LogPrintFatalf
+// and by a Server without Log. Passing nil restores the default, with
+// which these log plain lines to the standard logger as before, while
+// GetLogger returns a Logger backed by slog.Default.
+//
+// This function is threadsafe.
+func SetLogger(logger Logger) {
+	packageLoggerMutex.Lock()
+	packageLogger = logger
+	packageLoggerMutex.Unlock()
+}
+
+// GetLogger returns the Logger set by SetLogger, or the default.
+//
+// This function is threadsafe.
+func GetLogger() Logger {
+	if logger := setLogger(); logger != nil {
+		return logger
+	}
+	return SlogLogger(slog.Default())
+}
+
+// setLogger returns the Logger set by SetLogger, or nil.
+func setLogger() Logger {
+	packageLoggerMutex.RLock()
+	defer packageLoggerMutex.RUnlock()
+	return packageLogger
+}
+
+// loggerHandler returns the slog.Handler of logger, if it is backed by one.
+func loggerHandler(logger Logger) (slog.Handler, bool) {
+	if l, ok := logger.(interface{ Handler() slog.Handler }); ok {
+		return l.Handler(), true
+	}
+	return nil, false
+}
+
+// loggerEnabled reports whether logger emits records at level, which
+// allows to skip building expensive messages.
+func loggerEnabled(logger Logger, level slog.Level) bool {
+	if h, ok := loggerHandler(logger); ok {
+		return h.Enabled(context.Background(), level)
+	}
+	return true
+}
+
+// LogErrorf logs its arguments at error level to the Logger set by
+// SetLogger, or to the standard logger if there is none, and sets the exit
+// status of ExitWithStatus to 1.
 func LogErrorf(format string, args ...interface{}) {
-	log.Printf(format, args...)
+	if logger := setLogger(); logger == nil {
+		log.Printf(format, args...)
+	} else if loggerEnabled(logger, slog.LevelError) {
+		logger.Error(fmt.Sprintf(format, args...))
+	}
 	SetExitStatus(1)
 }
 
-// LogFatalf logs its arguments to the standard logger and
-// exits immediately.
+// LogFatalf logs its arguments like LogErrorf and exits immediately.
 func LogFatalf(format string, args ...interface{}) {
 	LogErrorf(format, args...)
 	ExitWithStatus()
 }
 
-// LogPrintFatalf logs its arguments to the standard logger as well as the
+// LogPrintFatalf logs its arguments like LogErrorf as well as to the
 // standard outout and exits immediately.
 func LogPrintFatalf(format string, args ...interface{}) {
 	fmt.Printf(format, args...)
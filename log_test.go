@@ -0,0 +1,85 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoggerWith(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	logger.With("component", "test").Warn("slow request", "path", "/a")
+	logger.Debug("hidden")
+	if line := buf.String(); !strings.Contains(line, "level=WARN") || !strings.Contains(line, "component=test") || !strings.Contains(line, "path=/a") {
+		t.Errorf("Unexpected log output %q", line)
+	}
+	if strings.Contains(buf.String(), "hidden") {
+		t.Error("Expected debug message to be filtered")
+	}
+}
+
+func TestLogErrorfUsesLogger(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(NewLogger(slog.NewTextHandler(&buf, nil)))
+	defer SetLogger(nil)
+	defer func() {
+		exitMutex.Lock()
+		exitStatus = 0
+		exitMutex.Unlock()
+	}()
+
+	LogErrorf("failed %d times", 3)
+	if line := buf.String(); !strings.Contains(line, "level=ERROR") || !strings.Contains(line, `msg="failed 3 times"`) {
+		t.Errorf("Unexpected log output %q", line)
+	}
+	if exitStatus != 1 {
+		t.Errorf("Expected exit status 1, but was %d", exitStatus)
+	}
+}
+
+func TestLogErrorfDefaultFormat(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer log.SetOutput(os.Stderr)
+	defer log.SetFlags(log.LstdFlags)
+	defer func() {
+		exitMutex.Lock()
+		exitStatus = 0
+		exitMutex.Unlock()
+	}()
+
+	LogErrorf("failed %d times", 3)
+	if line := buf.String(); line != "failed 3 times\n" {
+		t.Errorf("Expected unchanged log line, but was %q", line)
+	}
+}
+
+type failingReopener struct{}
+
+func (failingReopener) Reopen() error {
+	return errors.New("no such directory")
+}
+
+func TestServerReopenLogsToEmbeddedLogger(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(NewLogger(slog.NewTextHandler(io.Discard, nil)))
+	defer SetLogger(nil)
+
+	srv := &Server{Logger: log.New(&buf, "", 0), Reopeners: []Reopener{failingReopener{}}}
+	srv.reopen()
+	if line := buf.String(); line != "Failed to reopen: no such directory\n" {
+		t.Errorf("Expected failure to be logged to the embedded logger, but was %q", line)
+	}
+}
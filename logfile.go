@@ -0,0 +1,260 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Reopener is implemented by writers which reopen their files on request,
+// for example after logrotate moved them away.
+type Reopener interface {
+	Reopen() error
+}
+
+// LogFile is an io.Writer appending to a file, which can be reopened at
+// its original name and optionally rotates itself by size. It is safe for
+// concurrent use and can back a log.Logger, a Logger and an AccessLogger.
+//
+// Add it to the Reopeners of a Server to reopen it on SIGHUP.
+type LogFile struct {
+	// MaxSize makes writes rotate the file once it would grow beyond
+	// this many bytes. Zero disables rotation.
+	MaxSize int64
+
+	// Keep is the number of rotated files kept as name.1, name.2, ...,
+	// with name.1 being the most recent.
+	Keep int
+
+	// Compress rotated files with gzip, adding the suffix .gz.
+	Compress bool
+
+	name        string
+	perm        os.FileMode
+	mutex       sync.Mutex
+	compressing sync.Mutex
+	file        *os.File
+	size        int64
+}
+
+// OpenLogFile opens the file name for appending, creating it with perm if
+// it does not exist.
+func OpenLogFile(name string, perm os.FileMode) (*LogFile, error) {
+	f := &LogFile{name: name, perm: perm}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Name returns the name of the file.
+func (f *LogFile) Name() string {
+	return f.name
+}
+
+func (f *LogFile) open() error {
+	file, size, err := f.openFile()
+	if err != nil {
+		return err
+	}
+	f.file, f.size = file, size
+	return nil
+}
+
+// openFile opens the file at its name, returning it with its size.
+func (f *LogFile) openFile() (*os.File, int64, error) {
+	file, err := os.OpenFile(f.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, f.perm)
+	if err != nil {
+		return nil, 0, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, fi.Size(), nil
+}
+
+func (f *LogFile) Write(b []byte) (int, error) {
+	f.mutex.Lock()
+	if f.file == nil {
+		f.mutex.Unlock()
+		return 0, os.ErrClosed
+	}
+	var rotateErr error
+	// Rotation waits while a rotated file is still being compressed, the
+	// file grows beyond MaxSize meanwhile.
+	if f.MaxSize > 0 && f.size > 0 && f.size+int64(len(b)) > f.MaxSize && f.compressing.TryLock() {
+		compress := f.pendingCompression()
+		if compress == "" {
+			// Keep writing to the current file if rotating fails.
+			compress, rotateErr = f.rotate()
+		}
+		if compress != "" {
+			go func() {
+				defer f.compressing.Unlock()
+				// A failure leaves the rotated file uncompressed, to be
+				// retried before the next rotation.
+				compressFile(compress, compress+".gz", f.perm)
+			}()
+		} else {
+			f.compressing.Unlock()
+		}
+	}
+	n, err := 0, error(os.ErrClosed)
+	if f.file != nil {
+		n, err = f.file.Write(b)
+		f.size += int64(n)
+	}
+	f.mutex.Unlock()
+
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// Reopen opens the file again at its name, which creates a new file if the
+// old one was moved away. If that fails, writing continues with the
+// current file.
+func (f *LogFile) Reopen() error {
+	file, size, err := f.openFile()
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file, f.size = file, size
+	return nil
+}
+
+// Rotate moves the file to name.1, shifting older rotated files, and
+// continues with a new file. If that fails, writing continues with the
+// current file. Unlike rotation by size, Rotate compresses the rotated
+// file before returning.
+func (f *LogFile) Rotate() error {
+	f.compressing.Lock()
+	defer f.compressing.Unlock()
+	if pending := f.pendingCompression(); pending != "" {
+		if err := compressFile(pending, pending+".gz", f.perm); err != nil {
+			return err
+		}
+	}
+	f.mutex.Lock()
+	rotated, err := f.rotate()
+	f.mutex.Unlock()
+	if rotated != "" {
+		if compressErr := compressFile(rotated, rotated+".gz", f.perm); err == nil {
+			err = compressErr
+		}
+	}
+	return err
+}
+
+// pendingCompression returns name.1 if it was left uncompressed by a
+// failed compression. It needs to be compressed before rotating again, as
+// it would be overwritten otherwise.
+func (f *LogFile) pendingCompression() string {
+	if f.Keep <= 0 || !f.Compress {
+		return ""
+	}
+	first := f.name + ".1"
+	if _, err := os.Stat(first); err != nil {
+		return ""
+	}
+	return first
+}
+
+// rotate implements Rotate for callers holding both locks, returning the
+// name of the rotated file if it needs to be compressed. The file is open
+// afterwards, unless opening it failed.
+func (f *LogFile) rotate() (string, error) {
+	suffix := ""
+	if f.Compress {
+		suffix = ".gz"
+	}
+	rotated := func(i int) string {
+		return fmt.Sprintf("%s.%d%s", f.name, i, suffix)
+	}
+	first := fmt.Sprintf("%s.1", f.name)
+	if f.Keep > 0 {
+		os.Remove(rotated(f.Keep))
+		for i := f.Keep - 1; i > 0; i-- {
+			if err := os.Rename(rotated(i), rotated(i+1)); err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+	}
+
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	var err error
+	if f.Keep > 0 {
+		err = os.Rename(f.name, first)
+	} else {
+		err = os.Remove(f.name)
+	}
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	// Continue with a new file, or the current one if it could not be
+	// moved away.
+	if openErr := f.open(); openErr != nil {
+		return "", openErr
+	}
+	if err != nil || f.Keep <= 0 || !f.Compress {
+		return "", err
+	}
+	return first, nil
+}
+
+// compressFile writes src compressed with gzip to dst and removes src.
+func compressFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err == nil {
+		err = gz.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// Close closes the file, further writes fail. It waits for the
+// compression of a rotated file to finish.
+func (f *LogFile) Close() error {
+	f.compressing.Lock()
+	defer f.compressing.Unlock()
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,179 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readLogFile(t *testing.T, name string) string {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestLogFileReopen(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	f, err := OpenLogFile(name, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("first\n"))
+	if err := os.Rename(name, name+".old"); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("second\n"))
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("third\n"))
+
+	if content := readLogFile(t, name+".old"); content != "first\nsecond\n" {
+		t.Errorf("Unexpected content of moved file %q", content)
+	}
+	if content := readLogFile(t, name); content != "third\n" {
+		t.Errorf("Unexpected content of reopened file %q", content)
+	}
+}
+
+func TestLogFileRotateBySize(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	f, err := OpenLogFile(name, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.MaxSize = 10
+	f.Keep = 2
+	f.Compress = true
+
+	for _, line := range []string{"line one\n", "line two\n", "line three\n", "line four\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		// Wait for the compression in the background.
+		f.compressing.Lock()
+		f.compressing.Unlock()
+	}
+
+	if content := readLogFile(t, name); content != "line four\n" {
+		t.Errorf("Unexpected content of current file %q", content)
+	}
+	for suffix, expected := range map[string]string{".1.gz": "line three\n", ".2.gz": "line two\n"} {
+		file, err := os.Open(name + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(gz)
+		file.Close()
+		if string(content) != expected {
+			t.Errorf("Expected %s to contain %q, but was %q", suffix, expected, content)
+		}
+	}
+	if _, err := os.Stat(name + ".3.gz"); !os.IsNotExist(err) {
+		t.Errorf("Expected only %d rotated files to be kept", f.Keep)
+	}
+}
+
+func TestLogFileRotationFailure(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	f, err := OpenLogFile(name, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.MaxSize = 10
+	f.Keep = 2
+
+	// A non-empty directory in the way makes shifting name.1 fail.
+	os.WriteFile(name+".1", []byte("old\n"), 0644)
+	os.MkdirAll(filepath.Join(name+".2", "busy"), 0755)
+
+	f.Write([]byte("line one\n"))
+	if n, err := f.Write([]byte("line two\n")); err == nil || n != 9 {
+		t.Errorf("Expected line to be written despite rotation error, but got %d, %v", n, err)
+	}
+	if err := f.Rotate(); err == nil {
+		t.Error("Expected Rotate to fail")
+	}
+	f.Write([]byte("line three\n"))
+	if content := readLogFile(t, name); content != "line one\nline two\nline three\n" {
+		t.Errorf("Expected writing to continue with the current file, but was %q", content)
+	}
+
+	// A failed compression keeps the rotated file.
+	os.RemoveAll(name + ".2")
+	os.Remove(name + ".1")
+	os.MkdirAll(filepath.Join(name+".1.gz", "busy"), 0755)
+	f.Keep = 1
+	f.Compress = true
+	if err := f.Rotate(); err == nil {
+		t.Error("Expected compression to fail")
+	}
+	if content := readLogFile(t, name+".1"); content != "line one\nline two\nline three\n" {
+		t.Errorf("Expected uncompressed rotated file to be kept, but was %q", content)
+	}
+	if _, err := f.Write([]byte("line four\n")); err != nil {
+		t.Errorf("Expected writing to succeed after failed compression, but got %v", err)
+	}
+}
+
+func TestLogFileRotationDoesNotWaitForCompression(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	f, err := OpenLogFile(name, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.MaxSize = 10
+	f.Keep = 1
+	f.Compress = true
+
+	f.compressing.Lock()
+	f.Write([]byte("line one\n"))
+	f.Write([]byte("line two\n"))
+	f.compressing.Unlock()
+	if content := readLogFile(t, name); content != "line one\nline two\n" {
+		t.Errorf("Expected rotation to be postponed during compression, but file was %q", content)
+	}
+}
+
+func TestLogFileReopenFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	os.Mkdir(dir, 0755)
+	name := filepath.Join(dir, "app.log")
+	f, err := OpenLogFile(name, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("first\n"))
+	if err := os.Rename(dir, dir+".old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err == nil {
+		t.Error("Expected Reopen to fail without directory")
+	}
+	if _, err := f.Write([]byte("second\n")); err != nil {
+		t.Errorf("Expected writing to continue with the current file, but got %v", err)
+	}
+	if content := readLogFile(t, filepath.Join(dir+".old", "app.log")); content != "first\nsecond\n" {
+		t.Errorf("Unexpected content of current file %q", content)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Syslog severities, as used for the priority of journald and syslog
+// entries.
+const (
+	severityError   = 3
+	severityWarning = 4
+	severityInfo    = 6
+	severityDebug   = 7
+)
+
+// severity maps level to a syslog severity.
+func severity(level slog.Level) int {
+	switch {
+	case level < slog.LevelInfo:
+		return severityDebug
+	case level < slog.LevelWarn:
+		return severityInfo
+	case level < slog.LevelError:
+		return severityWarning
+	default:
+		return severityError
+	}
+}
+
+// sinkField is an attribute of a log record, Path holding the names of
+// its enclosing groups followed by its key.
+type sinkField struct {
+	Path  []string
+	Value string
+}
+
+type sinkRecord struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	Fields  []sinkField
+}
+
+// datagramSink sends records formatted by its sink to a Unix datagram
+// socket, writing them as text lines to a fallback writer if the socket
+// cannot be reached.
+type datagramSink struct {
+	path     string
+	fallback io.Writer
+	mutex    sync.Mutex
+	conn     *net.UnixConn
+}
+
+func (s *datagramSink) send(write func(conn *net.UnixConn) error, record *sinkRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: s.path, Net: "unixgram"})
+			if err != nil {
+				break
+			}
+			s.conn = conn
+		}
+		err := write(s.conn)
+		if err == nil {
+			return nil
+		}
+		// The receiver may have been restarted, connect again.
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	fallback := s.fallback
+	if fallback == nil {
+		fallback = os.Stderr
+	}
+	_, err := fallback.Write(formatFallback(record))
+	return err
+}
+
+func (s *datagramSink) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// formatFallback formats record as a text line.
+func formatFallback(record *sinkRecord) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(record.Time.Format(time.RFC3339))
+	buf.WriteByte(' ')
+	buf.WriteString(record.Level.String())
+	buf.WriteByte(' ')
+	buf.WriteString(record.Message)
+	appendFields(&buf, record.Fields)
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// appendFields appends fields to buf as space separated key=value pairs,
+// quoting values where needed.
+func appendFields(buf *bytes.Buffer, fields []sinkField) {
+	for _, field := range fields {
+		buf.WriteByte(' ')
+		buf.WriteString(strings.Join(field.Path, "."))
+		buf.WriteByte('=')
+		if field.Value == "" || strings.ContainsAny(field.Value, " \"=\n") {
+			buf.WriteString(strconv.Quote(field.Value))
+		} else {
+			buf.WriteString(field.Value)
+		}
+	}
+}
+
+// writeRecord returns the record for a Write of b to a sink used as
+// io.Writer, which logs b at info level.
+func writeRecord(b []byte) *sinkRecord {
+	return &sinkRecord{
+		Time:    time.Now(),
+		Level:   slog.LevelInfo,
+		Message: strings.TrimRight(string(b), "\n"),
+	}
+}
+
+// sinkHandler is a slog.Handler passing records to a sink.
+type sinkHandler struct {
+	send   func(*sinkRecord) error
+	level  slog.Leveler
+	fields []sinkField
+	groups []string
+}
+
+func newSinkHandler(send func(*sinkRecord) error, opts *slog.HandlerOptions) *sinkHandler {
+	h := &sinkHandler{send: send, level: slog.LevelInfo}
+	if opts != nil && opts.Level != nil {
+		h.level = opts.Level
+	}
+	return h
+}
+
+func (h *sinkHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *sinkHandler) Handle(ctx context.Context, r slog.Record) error {
+	record := &sinkRecord{
+		Time:    r.Time,
+		Level:   r.Level,
+		Message: r.Message,
+		Fields:  append([]sinkField(nil), h.fields...),
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		record.Fields = appendSinkField(record.Fields, h.groups, a)
+		return true
+	})
+	return h.send(record)
+}
+
+func (h *sinkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.fields = append([]sinkField(nil), h.fields...)
+	for _, a := range attrs {
+		clone.fields = appendSinkField(clone.fields, h.groups, a)
+	}
+	return &clone
+}
+
+func (h *sinkHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.groups = append(append([]string(nil), h.groups...), name)
+	return &clone
+}
+
+func appendSinkField(fields []sinkField, groups []string, a slog.Attr) []sinkField {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(append([]string(nil), groups...), a.Key)
+		}
+		for _, member := range a.Value.Group() {
+			fields = appendSinkField(fields, groups, member)
+		}
+		return fields
+	}
+	path := append(append([]string(nil), groups...), a.Key)
+	return append(fields, sinkField{Path: path, Value: a.Value.String()})
+}
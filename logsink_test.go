@@ -0,0 +1,90 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func listenDatagrams(t *testing.T) (string, func() string) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("Unix datagram sockets not available: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return path, func() string {
+		buf := make([]byte, 65536)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Failed to receive datagram: %v", err)
+		}
+		return string(buf[:n])
+	}
+}
+
+func TestJournalWriter(t *testing.T) {
+	path, receive := listenDatagrams(t)
+	journal := NewJournalWriter(path, nil)
+	journal.Identifier = "test"
+	defer journal.Close()
+
+	logger := NewLogger(journal.Handler(nil))
+	logger.With("request", slog.GroupValue(slog.String("path", "/a"))).Warn("slow", "lines", "one\ntwo")
+
+	var expected bytes.Buffer
+	expected.WriteString("MESSAGE=slow\nPRIORITY=4\nSYSLOG_IDENTIFIER=test\nREQUEST_PATH=/a\nLINES\n")
+	binary.Write(&expected, binary.LittleEndian, uint64(7))
+	expected.WriteString("one\ntwo\n")
+	if entry := receive(); entry != expected.String() {
+		t.Errorf("Expected entry %q, but was %q", expected.String(), entry)
+	}
+
+	journal.Write([]byte("GET / 200\n"))
+	if entry := receive(); !strings.HasPrefix(entry, "MESSAGE=GET / 200\nPRIORITY=6\n") {
+		t.Errorf("Unexpected entry %q", entry)
+	}
+}
+
+func TestSyslogWriter(t *testing.T) {
+	path, receive := listenDatagrams(t)
+	syslog := NewSyslogWriter(path, nil)
+	syslog.Facility = 16
+	syslog.AppName = "test"
+	syslog.Hostname = "host"
+	defer syslog.Close()
+
+	logger := NewLogger(syslog.Handler(&slog.HandlerOptions{Level: slog.LevelDebug}))
+	logger.Error("failed", "user", "anna smith")
+	expected := regexp.MustCompile(`^<131>1 \d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{6}(Z|[+-]\d{2}:\d{2}) host test \d+ - - failed user="anna smith"$`)
+	if entry := receive(); !expected.MatchString(entry) {
+		t.Errorf("Unexpected entry %q", entry)
+	}
+
+	syslog.StructuredDataID = "fields@32473"
+	logger.Debug("details", "note", `a "b"`)
+	if entry := receive(); !strings.HasSuffix(entry, ` - [fields@32473 note="a \"b\""] details`) || !strings.HasPrefix(entry, "<135>1 ") {
+		t.Errorf("Unexpected entry %q", entry)
+	}
+}
+
+func TestLogSinkFallback(t *testing.T) {
+	var buf bytes.Buffer
+	journal := NewJournalWriter(filepath.Join(t.TempDir(), "missing.sock"), &buf)
+
+	NewLogger(journal.Handler(nil)).Info("no journal", "id", 7)
+	if line := buf.String(); !strings.HasSuffix(line, ` INFO no journal id=7`+"\n") {
+		t.Errorf("Unexpected fallback line %q", line)
+	}
+}
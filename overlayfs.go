@@ -0,0 +1,176 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueMarker   = whiteoutPrefix + whiteoutPrefix + ".opq"
+)
+
+type overlayFileSystem []http.FileSystem
+
+// OverlayFileSystem returns an http.FileSystem which combines layers, such
+// that files are opened from the first layer containing them. Directory
+// listings are merged across all layers.
+//
+// A layer can hide a file or directory of the layers below it through a
+// whiteout marker, an entry named ".wh.<name>" next to where <name> would
+// be. A directory containing an entry named ".wh..wh..opq" hides the same
+// directory in all layers below. Whiteout markers themselves are never
+// served.
+//
+// For example, to let files in /etc/myapp/www override the defaults:
+//
+//	fs := OverlayFileSystem(http.Dir("/etc/myapp/www"), http.Dir("/usr/share/myapp/www"))
+//	http.Handle("/static/", http.StripPrefix("/static", FileStaticServer(fs)))
+func OverlayFileSystem(layers ...http.FileSystem) http.FileSystem {
+	return overlayFileSystem(layers)
+}
+
+// Open implements http.FileSystem.
+func (o overlayFileSystem) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+	if strings.HasPrefix(path.Base(name), whiteoutPrefix) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	var dirs []http.File
+	for _, layer := range o {
+		f, err := layer.Open(name)
+		if err != nil {
+			if isHiddenBy(layer, name) {
+				break
+			}
+			continue
+		}
+		fi, err := f.Stat()
+		if err != nil || !fi.IsDir() {
+			if len(dirs) == 0 {
+				return f, nil
+			}
+			// Files never shadow directories from a layer above.
+			f.Close()
+			continue
+		}
+		dirs = append(dirs, f)
+		if exists(layer, path.Join(name, opaqueMarker)) {
+			break
+		}
+	}
+	if len(dirs) == 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return &overlayDir{File: dirs[0], dirs: dirs}, nil
+}
+
+// isHiddenBy returns true if layer contains a whiteout marker for name or
+// any of its parents, or if one of the parents is an opaque directory.
+func isHiddenBy(layer http.FileSystem, name string) bool {
+	for p := name; p != "/"; p = path.Dir(p) {
+		dir, base := path.Split(p)
+		if exists(layer, path.Join(dir, whiteoutPrefix+base)) {
+			return true
+		}
+		if p != name && exists(layer, path.Join(p, opaqueMarker)) {
+			return true
+		}
+	}
+	return false
+}
+
+func exists(fs http.FileSystem, name string) bool {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// overlayDir is a directory of an overlayFileSystem. Its os.FileInfo is
+// taken from the topmost layer.
+type overlayDir struct {
+	http.File
+	dirs    []http.File
+	entries []os.FileInfo
+	offset  int
+}
+
+func (d *overlayDir) Close() error {
+	var err error
+	for _, dir := range d.dirs {
+		if e := dir.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (d *overlayDir) Readdir(count int) ([]os.FileInfo, error) {
+	if d.entries == nil {
+		entries, err := d.merge()
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+	}
+	remaining := d.entries[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(remaining) {
+		count = len(remaining)
+	}
+	d.offset += count
+	return remaining[:count], nil
+}
+
+func (d *overlayDir) merge() ([]os.FileInfo, error) {
+	entries := []os.FileInfo{}
+	seen := make(map[string]bool)
+	for _, dir := range d.dirs {
+		infos, err := dir.Readdir(-1)
+		if err != nil {
+			return nil, err
+		}
+		var whiteouts []string
+		for _, fi := range infos {
+			name := fi.Name()
+			switch {
+			case name == opaqueMarker:
+			case strings.HasPrefix(name, whiteoutPrefix):
+				whiteouts = append(whiteouts, name[len(whiteoutPrefix):])
+			case !seen[name]:
+				seen[name] = true
+				entries = append(entries, fi)
+			}
+		}
+		// Whiteouts only apply to the layers below.
+		for _, name := range whiteouts {
+			seen[name] = true
+		}
+	}
+	sort.Sort(byName(entries))
+	return entries, nil
+}
+
+type byName []os.FileInfo
+
+func (s byName) Len() int           { return len(s) }
+func (s byName) Less(i, j int) bool { return s[i].Name() < s[j].Name() }
+func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
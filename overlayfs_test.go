@@ -0,0 +1,98 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTree(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func makeOverlay(t *testing.T) http.FileSystem {
+	override := writeTree(t, map[string]string{
+		"css/theme.css":      "custom",
+		"css/.wh.legacy.css": "",
+		".wh.plugins":        "",
+		"img/.wh..wh..opq":   "",
+		"img/logo.png":       "custom logo",
+	})
+	defaults := writeTree(t, map[string]string{
+		"css/theme.css":   "default",
+		"css/base.css":    "base",
+		"css/legacy.css":  "legacy",
+		"plugins/a.js":    "plugin",
+		"img/logo.png":    "default logo",
+		"img/favicon.ico": "icon",
+	})
+	return OverlayFileSystem(http.Dir(override), http.Dir(defaults))
+}
+
+func TestOverlayFileSystem_ServeFile(t *testing.T) {
+	fs := makeOverlay(t)
+	for path, expected := range map[string]string{
+		"/css/theme.css":      "custom",
+		"/css/base.css":       "base",
+		"/css/legacy.css":     "",
+		"/css/.wh.legacy.css": "",
+		"/plugins/a.js":       "",
+		"/img/logo.png":       "custom logo",
+		"/img/favicon.ico":    "",
+	} {
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		ServeFile(w, r, fs, path)
+		if expected == "" {
+			if w.Code != http.StatusNotFound {
+				t.Errorf("Expected %s to be hidden, but got status %d", path, w.Code)
+			}
+		} else if body := w.Body.String(); body != expected {
+			t.Errorf("Expected %s to contain '%s', but was '%s' (%d)", path, expected, body, w.Code)
+		}
+	}
+}
+
+func TestOverlayFileSystem_MergesDirectories(t *testing.T) {
+	fs := makeOverlay(t)
+	for dir, expected := range map[string]string{
+		"/":    "css img",
+		"/css": "base.css theme.css",
+		"/img": "logo.png",
+	} {
+		f, err := fs.Open(dir)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", dir, err)
+		}
+		infos, err := f.Readdir(-1)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", dir, err)
+		}
+		var names []string
+		for _, fi := range infos {
+			names = append(names, fi.Name())
+		}
+		if actual := strings.Join(names, " "); actual != expected {
+			t.Errorf("Expected %s to list '%s', but was '%s'", dir, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Media types of problem details objects.
+const (
+	ProblemJSONType = "application/problem+json"
+	ProblemXMLType  = "application/problem+xml"
+)
+
+// Problem is a problem details object as specified by RFC 9457, a
+// machine-readable format for errors in HTTP responses.
+type Problem struct {
+	// Type is a URI reference identifying the problem type. When empty,
+	// "about:blank" is implied.
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+
+	// Extensions holds additional members, which must not use the names
+	// of the standard members above.
+	Extensions map[string]interface{}
+}
+
+// NewProblem returns a Problem for status with the standard status text
+// as title and the given detail, which may be empty.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Error implements error.
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Title + ": " + p.Detail
+	}
+	return p.Title
+}
+
+// MarshalJSON encodes p with its extensions as members of the same object.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]interface{}, len(p.Extensions)+5)
+	for name, value := range p.Extensions {
+		members[name] = value
+	}
+	for name, value := range map[string]string{
+		"type":     p.Type,
+		"title":    p.Title,
+		"detail":   p.Detail,
+		"instance": p.Instance,
+	} {
+		if value != "" {
+			members[name] = value
+		}
+	}
+	if p.Status != 0 {
+		members["status"] = p.Status
+	}
+	return json.Marshal(members)
+}
+
+// MarshalXML encodes p as described in appendix B of RFC 9457.
+func (p *Problem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Space: "urn:ietf:rfc:7807", Local: "problem"}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, member := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"type", p.Type},
+		{"title", p.Title},
+		{"status", p.Status},
+		{"detail", p.Detail},
+		{"instance", p.Instance},
+	} {
+		if member.value == "" || member.value == 0 {
+			continue
+		}
+		if err := e.EncodeElement(member.value, xml.StartElement{Name: xml.Name{Local: member.name}}); err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(p.Extensions))
+	for name := range p.Extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := e.EncodeElement(p.Extensions[name], xml.StartElement{Name: xml.Name{Local: name}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// WriteProblem responds to r with p, encoded as application/problem+json
+// or application/problem+xml depending on the Accept header of r. JSON is
+// used unless the client prefers XML.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	status := p.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+
+	var buf bytes.Buffer
+	contentType, _ := Negotiate(r, ProblemJSONType, ProblemXMLType)
+	if contentType == ProblemXMLType {
+		buf.WriteString(xml.Header)
+		xml.NewEncoder(&buf).Encode(p)
+	} else {
+		contentType = ProblemJSONType
+		json.NewEncoder(&buf).Encode(p)
+	}
+
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	h.Set("Content-Type", contentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	addVary(h, "Accept")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// httpError responds to r with status, either as a problem details object
+// or as plain text like http.Error.
+func httpError(w http.ResponseWriter, r *http.Request, status int, problemDetails bool) {
+	httpErrorDetail(w, r, status, "", problemDetails)
+}
+
+// httpErrorDetail is like httpError, adding detail to the response if it
+// is not empty.
+func httpErrorDetail(w http.ResponseWriter, r *http.Request, status int, detail string, problemDetails bool) {
+	if problemDetails {
+		WriteProblem(w, r, NewProblem(status, detail))
+		return
+	}
+	text := fmt.Sprintf("%d %s", status, http.StatusText(status))
+	if detail != "" {
+		text += ": " + detail
+	}
+	http.Error(w, text, status)
+}
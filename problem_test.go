@@ -0,0 +1,67 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteProblem(t *testing.T) {
+	problem := &Problem{
+		Type:       "https://example.com/probs/out-of-credit",
+		Title:      "You do not have enough credit.",
+		Status:     http.StatusForbidden,
+		Detail:     "Your current balance is 30, but that costs 50.",
+		Instance:   "/account/12345/msgs/abc",
+		Extensions: map[string]interface{}{"balance": 30},
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	WriteProblem(w, r, problem)
+	if w.Code != http.StatusForbidden || w.Header().Get("Content-Type") != ProblemJSONType {
+		t.Errorf("Unexpected response %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to unmarshal problem: %v", err)
+	}
+	for name, expected := range map[string]interface{}{
+		"type":     problem.Type,
+		"title":    problem.Title,
+		"status":   float64(problem.Status),
+		"detail":   problem.Detail,
+		"instance": problem.Instance,
+		"balance":  float64(30),
+	} {
+		if body[name] != expected {
+			t.Errorf("Expected member %s to be %v, but was %v", name, expected, body[name])
+		}
+	}
+
+	r.Header.Set("Accept", "application/xml")
+	w = httptest.NewRecorder()
+	WriteProblem(w, r, problem)
+	expected := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<problem xmlns="urn:ietf:rfc:7807"><type>https://example.com/probs/out-of-credit</type>` +
+		`<title>You do not have enough credit.</title><status>403</status>` +
+		`<detail>Your current balance is 30, but that costs 50.</detail>` +
+		`<instance>/account/12345/msgs/abc</instance><balance>30</balance></problem>`
+	if w.Header().Get("Content-Type") != ProblemXMLType || w.Body.String() != expected {
+		t.Errorf("Unexpected XML problem %s: %s", w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
+
+func TestServeFileWithOptions_ProblemDetails(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/missing", nil)
+	w := httptest.NewRecorder()
+	ServeFileWithOptions(w, r, http.Dir(t.TempDir()), "/missing", &FileOptions{ProblemDetails: true})
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != ProblemJSONType {
+		t.Errorf("Expected problem details with status %d, but got %d %s", http.StatusNotFound, w.Code, w.Header().Get("Content-Type"))
+	}
+}
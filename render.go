@@ -0,0 +1,146 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+)
+
+// Renderer encodes values in a specific format for a response.
+type Renderer interface {
+	Render(w io.Writer, v interface{}) error
+}
+
+// RendererFunc is an adapter to use ordinary functions as Renderer.
+type RendererFunc func(w io.Writer, v interface{}) error
+
+// Render calls f(w, v).
+func (f RendererFunc) Render(w io.Writer, v interface{}) error {
+	return f(w, v)
+}
+
+// JSONRenderer encodes values with encoding/json.
+var JSONRenderer = RendererFunc(func(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+})
+
+// XMLRenderer encodes values with encoding/xml.
+var XMLRenderer = RendererFunc(func(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+})
+
+// CSVMarshaler is implemented by values which can be rendered as CSV.
+type CSVMarshaler interface {
+	MarshalCSV() ([][]string, error)
+}
+
+// CSVRenderer encodes values of type [][]string or implementing
+// CSVMarshaler with encoding/csv.
+var CSVRenderer = RendererFunc(func(w io.Writer, v interface{}) error {
+	var records [][]string
+	switch value := v.(type) {
+	case [][]string:
+		records = value
+	case CSVMarshaler:
+		var err error
+		if records, err = value.MarshalCSV(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("cannot render %T as CSV", v)
+	}
+	return csv.NewWriter(w).WriteAll(records)
+})
+
+// HTMLTemplateRenderer returns a Renderer executing t with the value.
+func HTMLTemplateRenderer(t *template.Template) Renderer {
+	return RendererFunc(func(w io.Writer, v interface{}) error {
+		return t.Execute(w, v)
+	})
+}
+
+// Renderers selects a Renderer for a response by content negotiation.
+//
+// Renderers must be registered before Render is used.
+type Renderers struct {
+	// Fallback, when set, is the registered media type used if the client
+	// accepts none of them. Otherwise such requests are answered with
+	// 406 Not Acceptable.
+	Fallback string
+
+	// ProblemDetails enables sending encoding errors as problem details
+	// objects (RFC 9457) instead of plain text.
+	ProblemDetails bool
+
+	mediaTypes []string
+	renderers  map[string]Renderer
+}
+
+// DefaultRenderers is used by Render and knows JSON and XML.
+var DefaultRenderers = NewRenderers()
+
+func init() {
+	DefaultRenderers.Register("application/json", JSONRenderer)
+	DefaultRenderers.Register("application/xml", XMLRenderer)
+}
+
+// NewRenderers returns an empty Renderers.
+func NewRenderers() *Renderers {
+	return &Renderers{renderers: make(map[string]Renderer)}
+}
+
+// Register adds renderer for mediaType, which is sent as Content-Type and
+// should thus include a charset parameter for text types. Media types
+// registered first are preferred when the client has no preference.
+func (rs *Renderers) Register(mediaType string, renderer Renderer) {
+	if _, ok := rs.renderers[mediaType]; !ok {
+		rs.mediaTypes = append(rs.mediaTypes, mediaType)
+	}
+	rs.renderers[mediaType] = renderer
+}
+
+// Render responds to r with status and v encoded in the format preferred
+// by the client. Encoding happens before anything is written, so that
+// encoding errors result in 500 Internal Server Error. They are also
+// returned.
+func (rs *Renderers) Render(w http.ResponseWriter, r *http.Request, status int, v interface{}) error {
+	addVary(w.Header(), "Accept")
+	mediaType, ok := Negotiate(r, rs.mediaTypes...)
+	if !ok {
+		if _, registered := rs.renderers[rs.Fallback]; !registered {
+			writeContentTypeError(w, r, http.StatusNotAcceptable, rs.mediaTypes)
+			return nil
+		}
+		mediaType = rs.Fallback
+	}
+
+	var buf bytes.Buffer
+	if err := rs.renderers[mediaType].Render(&buf, v); err != nil {
+		httpError(w, r, http.StatusInternalServerError, rs.ProblemDetails)
+		return err
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(status)
+	if r.Method != "HEAD" {
+		_, err := buf.WriteTo(w)
+		return err
+	}
+	return nil
+}
+
+// Render responds to r with status and v using DefaultRenderers.
+func Render(w http.ResponseWriter, r *http.Request, status int, v interface{}) error {
+	return DefaultRenderers.Render(w, r, status, v)
+}
@@ -0,0 +1,69 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type renderTestValue struct {
+	Name  string `json:"name" xml:"name"`
+	Count int    `json:"count" xml:"count"`
+}
+
+func (v renderTestValue) MarshalCSV() ([][]string, error) {
+	return [][]string{{"name", "count"}, {v.Name, "3"}}, nil
+}
+
+func TestRenderers_Render(t *testing.T) {
+	renderers := NewRenderers()
+	renderers.Register("application/json", JSONRenderer)
+	renderers.Register("application/xml", XMLRenderer)
+	renderers.Register("text/csv; charset=utf-8", CSVRenderer)
+	renderers.Register("text/html; charset=utf-8", HTMLTemplateRenderer(template.Must(template.New("").Parse("<p>{{.Name}}</p>"))))
+	value := renderTestValue{"<widgets>", 3}
+
+	for _, test := range []struct {
+		accept, contentType, body string
+	}{
+		{"", "application/json", "{\"name\":\"\\u003cwidgets\\u003e\",\"count\":3}\n"},
+		{"application/xml", "application/xml", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<renderTestValue><name>&lt;widgets&gt;</name><count>3</count></renderTestValue>"},
+		{"text/csv", "text/csv; charset=utf-8", "name,count\n<widgets>,3\n"},
+		{"text/html,*/*;q=0.8", "text/html; charset=utf-8", "<p>&lt;widgets&gt;</p>"},
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+		if err := renderers.Render(w, r, http.StatusCreated, value); err != nil {
+			t.Errorf("Failed to render for '%s': %v", test.accept, err)
+		}
+		if w.Code != http.StatusCreated || w.Header().Get("Content-Type") != test.contentType || w.Body.String() != test.body {
+			t.Errorf("Unexpected response for '%s': %d %s %q", test.accept, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept" {
+			t.Errorf("Expected Vary to be Accept, but was '%s'", vary)
+		}
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "image/png")
+	w := httptest.NewRecorder()
+	renderers.Render(w, r, http.StatusOK, value)
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected unacceptable request to return %d, but was %d", http.StatusNotAcceptable, w.Code)
+	}
+
+	renderers.Fallback = "application/json"
+	w = httptest.NewRecorder()
+	renderers.Render(w, r, http.StatusOK, value)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected fallback to JSON, but got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrEscapesRoot is returned by ConfinedDir when a path resolves to a
+// location outside of its root directory.
+var ErrEscapesRoot = errors.New("path escapes from root directory")
+
+// ConfinedDir implements http.FileSystem using the native file system
+// restricted to a specific directory tree, like http.Dir.
+//
+// Unlike http.Dir, symbolic links are resolved and any path which would
+// end up outside of the directory tree is refused with ErrEscapesRoot.
+// Links pointing to other locations within the tree continue to work.
+//
+// On Linux, openat2(2) with RESOLVE_BENEATH is used so that resolving and
+// opening happen atomically in the kernel. On other systems, when the
+// kernel does not support openat2, or for paths containing absolute links,
+// the path is resolved and checked before it is opened.
+//
+// An empty ConfinedDir is treated as ".".
+type ConfinedDir string
+
+// Open implements http.FileSystem.
+func (d ConfinedDir) Open(name string) (http.File, error) {
+	if filepath.Separator != '/' && strings.ContainsRune(name, filepath.Separator) {
+		return nil, errors.New("http: invalid character in file path")
+	}
+	dir := string(d)
+	if dir == "" {
+		dir = "."
+	}
+	rel := strings.TrimPrefix(filepath.FromSlash(path.Clean("/"+name)), string(filepath.Separator))
+	if rel == "" {
+		rel = "."
+	}
+	return openConfined(dir, rel)
+}
+
+// openConfinedPortable opens rel within dir by resolving all symbolic links
+// first and making sure the result still lies within dir.
+func openConfinedPortable(dir, rel string) (http.File, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return nil, err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, rel))
+	if err != nil {
+		return nil, err
+	}
+	if !isWithin(root, resolved) {
+		return nil, &os.PathError{Op: "open", Path: filepath.Join(dir, rel), Err: ErrEscapesRoot}
+	}
+	return os.Open(resolved)
+}
+
+// isWithin returns true if target is root or below it.
+func isWithin(root, target string) bool {
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,79 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// Not (yet) provided by package syscall, see openat2(2).
+const (
+	sysOpenat2          = 437
+	oPath               = 0x200000
+	resolveNoMagiclinks = 0x02
+	resolveBeneath      = 0x08
+)
+
+type openHow struct {
+	flags   uint64
+	mode    uint64
+	resolve uint64
+}
+
+// Set once openat2 turned out to be unavailable, so we don't keep trying.
+var openat2Unsupported int32
+
+func openConfined(dir, rel string) (http.File, error) {
+	if atomic.LoadInt32(&openat2Unsupported) == 0 {
+		f, err := openBeneath(dir, rel)
+		switch err {
+		case syscall.ENOSYS:
+			atomic.StoreInt32(&openat2Unsupported, 1)
+		case syscall.EPERM:
+			// Some seccomp filters deny unknown syscalls with EPERM.
+		case syscall.EXDEV:
+			// The kernel refuses absolute links altogether, even when
+			// they point back into the tree, so have another look.
+		case nil:
+			return f, nil
+		default:
+			return nil, &os.PathError{Op: "open", Path: filepath.Join(dir, rel), Err: err}
+		}
+	}
+	return openConfinedPortable(dir, rel)
+}
+
+func openBeneath(dir, rel string) (*os.File, error) {
+	rootfd, err := syscall.Open(dir, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC|oPath, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(rootfd)
+
+	name, err := syscall.BytePtrFromString(rel)
+	if err != nil {
+		return nil, err
+	}
+	how := openHow{
+		flags:   uint64(syscall.O_RDONLY | syscall.O_CLOEXEC),
+		resolve: resolveBeneath | resolveNoMagiclinks,
+	}
+	for {
+		fd, _, errno := syscall.Syscall6(sysOpenat2, uintptr(rootfd), uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(&how)), unsafe.Sizeof(how), 0, 0)
+		switch errno {
+		case 0:
+			return os.NewFile(fd, filepath.Join(dir, rel)), nil
+		case syscall.EINTR:
+			continue
+		default:
+			return nil, errno
+		}
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package httputils
+
+import (
+	"net/http"
+)
+
+func openConfined(dir, rel string) (http.File, error) {
+	return openConfinedPortable(dir, rel)
+}
@@ -0,0 +1,91 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func makeConfinedTree(t *testing.T) (root, outside string) {
+	base := t.TempDir()
+	root = filepath.Join(base, "root")
+	outside = filepath.Join(base, "secret.txt")
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		outside:                             "secret",
+		filepath.Join(root, "sub", "a.txt"): "hello",
+	} {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"inside":   filepath.Join("sub", "a.txt"),
+		"absolute": filepath.Join(root, "sub", "a.txt"),
+		"escape":   filepath.Join("..", "secret.txt"),
+		"subdir":   "sub",
+		"up":       "..",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skipf("Symlinks not supported: %v", err)
+		}
+	}
+	return root, outside
+}
+
+func TestConfinedDir_Open(t *testing.T) {
+	root, _ := makeConfinedTree(t)
+	openers := map[string]func(name string) (http.File, error){
+		"ConfinedDir": ConfinedDir(root).Open,
+		"portable": func(name string) (http.File, error) {
+			return openConfinedPortable(root, filepath.FromSlash(name))
+		},
+	}
+	for kind, open := range openers {
+		for _, name := range []string{"sub/a.txt", "inside", "absolute", "subdir/a.txt"} {
+			f, err := open(name)
+			if err != nil {
+				t.Errorf("%s: expected %s to be opened, but got %v", kind, name, err)
+				continue
+			}
+			data, _ := ioutil.ReadAll(f)
+			f.Close()
+			if string(data) != "hello" {
+				t.Errorf("%s: expected %s to contain 'hello', but was '%s'", kind, name, data)
+			}
+		}
+		for _, name := range []string{"escape", "up/secret.txt"} {
+			if f, err := open(name); err == nil {
+				f.Close()
+				t.Errorf("%s: expected %s to be refused", kind, name)
+			}
+		}
+	}
+}
+
+func TestConfinedDir_ServeFile(t *testing.T) {
+	root, _ := makeConfinedTree(t)
+	for path, code := range map[string]int{
+		"/sub/a.txt":        http.StatusOK,
+		"/escape":           http.StatusNotFound,
+		"/../secret.txt":    http.StatusNotFound,
+		"/up/secret.txt":    http.StatusNotFound,
+		"/subdir/../escape": http.StatusNotFound,
+	} {
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		ServeFile(w, r, ConfinedDir(root), path)
+		if w.Code != code {
+			t.Errorf("Expected %s to return %d, but was %d", path, code, w.Code)
+		}
+	}
+}
@@ -10,12 +10,15 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
 // Provide a HTTP server implementation which can listen on TPC
@@ -23,9 +26,24 @@ import (
 type Server struct {
 	http.Server
 	*log.Logger
-	listener net.Listener
-	closing  bool
-	quit     chan struct{}
+	// Log receives the messages of the server. If nil, they go to the
+	// embedded *log.Logger, the Logger set by SetLogger or the standard
+	// logger, whichever is found first. If Log is backed by a
+	// slog.Handler and ErrorLog is nil, errors of the embedded http.Server
+	// are logged to it as well.
+	Log Logger
+	// Reopeners are reopened when the server receives SIGHUP while
+	// serving until signalled, for example LogFiles rotated by logrotate.
+	// SIGHUP is left to its default handling if there are none.
+	Reopeners []Reopener
+	// DrainTimeout is how long Stop keeps serving after marking the server
+	// as draining, giving load balancers time to notice failing readiness
+	// checks before the socket closes.
+	DrainTimeout time.Duration
+	listener     net.Listener
+	closing      bool
+	draining     int32
+	quit         chan struct{}
 }
 
 // Listen binds sockets according to the configuration of srv.
@@ -123,6 +141,13 @@ func (srv *Server) Start() error {
 		return fmt.Errorf("Listen must be called before Start")
 	}
 
+	if srv.ErrorLog == nil && srv.Log != nil {
+		if h, ok := loggerHandler(srv.Log); ok {
+			srv.ErrorLog = slog.NewLogLogger(h, slog.LevelError)
+		}
+	}
+
+	atomic.StoreInt32(&srv.draining, 0)
 	failed := make(chan error)
 	go func() {
 		failed <- srv.Serve(srv.listener)
@@ -146,24 +171,52 @@ func (srv *Server) Stop() error {
 		return fmt.Errorf("Server was not started")
 	}
 
+	atomic.StoreInt32(&srv.draining, 1)
+	if srv.DrainTimeout > 0 {
+		time.Sleep(srv.DrainTimeout)
+	}
+
 	srv.closing = true
 	err := srv.listener.Close()
 	srv.quit <- struct{}{}	
 	return err
 }
 
+// Draining reports whether Stop was called and the server is about to
+// close.
+func (srv *Server) Draining() bool {
+	return atomic.LoadInt32(&srv.draining) != 0
+}
+
 func (srv *Server) serveUntilSignalled() error {
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
 	defer signal.Stop(sig)
 
+	if len(srv.Reopeners) > 0 {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				select {
+				case <-hup:
+					srv.reopen()
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
 	go func() {
 		s := <-sig
-		msg := "Received exit signal %d - Closing ..."
-		if srv.Logger != nil {
-			srv.Logger.Printf(msg, s)
+		if printf := srv.printf(); printf != nil {
+			printf("Received exit signal %d - Closing ...", s)
 		} else {
-			log.Printf(msg, s)
+			srv.logger().Info("Received exit signal - Closing ...", "signal", s.String())
 		}
 		srv.Stop()
 	}()
@@ -171,6 +224,42 @@ func (srv *Server) serveUntilSignalled() error {
 	return srv.Start()
 }
 
+// reopen reopens the Reopeners of srv, logging failures.
+func (srv *Server) reopen() {
+	for _, reopener := range srv.Reopeners {
+		if err := reopener.Reopen(); err == nil {
+			continue
+		} else if printf := srv.printf(); printf != nil {
+			printf("Failed to reopen: %v", err)
+		} else {
+			srv.logger().Error("Failed to reopen", "error", err)
+		}
+	}
+}
+
+// printf returns the Printf of the embedded *log.Logger or of the standard
+// logger if messages of srv go there, as described for Log, and nil if
+// they go to a Logger.
+func (srv *Server) printf() func(format string, v ...interface{}) {
+	switch {
+	case srv.Log != nil:
+		return nil
+	case srv.Logger != nil:
+		return srv.Logger.Printf
+	case setLogger() == nil:
+		return log.Printf
+	}
+	return nil
+}
+
+// logger returns the Logger for messages of srv if printf returns nil.
+func (srv *Server) logger() Logger {
+	if srv.Log != nil {
+		return srv.Log
+	}
+	return GetLogger()
+}
+
 func (srv *Server) socketListen(addr string) (net.Listener, error) {
 
 	var err error
@@ -0,0 +1,154 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Errors returned by URLSigner.Verify.
+var (
+	ErrURLNotSigned        = errors.New("url is not signed")
+	ErrURLExpired          = errors.New("url has expired")
+	ErrURLSignatureInvalid = errors.New("url signature is invalid")
+)
+
+// SigningKey is a secret used by URLSigner, identified by ID.
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// URLSigner creates and verifies expiring URLs signed with HMAC-SHA256,
+// for example to hand out links to a FileDownloadServer without further
+// authentication.
+//
+// The signature covers the path and all query parameters of the URL.
+// Signed URLs carry the additional query parameters expires, kid and sig.
+//
+// New URLs are signed with the first of Keys, while all of them are
+// accepted for verification. To rotate keys, put a new key in front and
+// remove the old one once all URLs signed with it have expired.
+type URLSigner struct {
+	Keys []SigningKey
+
+	// BindClientIP makes signatures valid for a single client address.
+	BindClientIP bool
+
+	// ClientIP returns the client address of r used with BindClientIP.
+	// When nil, the host part of r.RemoteAddr is used.
+	ClientIP func(r *http.Request) string
+
+	// ProblemDetails enables sending errors as problem details objects
+	// (RFC 9457) instead of plain text.
+	ProblemDetails bool
+}
+
+// Sign returns rawurl signed to be valid until expires. The clientIP is
+// only used with BindClientIP, and ignored otherwise. It must match what
+// ClientIP returns for the requests of the client.
+func (s *URLSigner) Sign(rawurl string, expires time.Time, clientIP string) (string, error) {
+	if len(s.Keys) == 0 {
+		return "", errors.New("no signing key")
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	if !s.BindClientIP {
+		clientIP = ""
+	}
+	key := s.Keys[0]
+	query := u.Query()
+	query.Del("sig")
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	if key.ID != "" {
+		query.Set("kid", key.ID)
+	} else {
+		query.Del("kid")
+	}
+	query.Set("sig", s.signature(key, u.EscapedPath(), query, clientIP))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Verify checks that the URL of r carries a valid signature which has not
+// yet expired.
+func (s *URLSigner) Verify(r *http.Request) error {
+	query := r.URL.Query()
+	sig := query.Get("sig")
+	if sig == "" {
+		return ErrURLNotSigned
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return ErrURLSignatureInvalid
+	}
+
+	clientIP := ""
+	if s.BindClientIP {
+		clientIP = s.clientIP(r)
+	}
+	kid := query.Get("kid")
+	for _, key := range s.Keys {
+		if key.ID != kid {
+			continue
+		}
+		expected := s.signature(key, r.URL.EscapedPath(), query, clientIP)
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			if time.Now().Unix() > expires {
+				return ErrURLExpired
+			}
+			return nil
+		}
+	}
+	return ErrURLSignatureInvalid
+}
+
+// Handler returns a handler which passes requests with a valid signature
+// to h and responds to all others with 403 Forbidden.
+//
+// As the signature covers the path, wrap the handler before any
+// http.StripPrefix.
+func (s *URLSigner) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Verify(r); err != nil {
+			httpError(w, r, http.StatusForbidden, s.ProblemDetails)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *URLSigner) signature(key SigningKey, escapedPath string, query url.Values, clientIP string) string {
+	signed := url.Values{}
+	for name, values := range query {
+		if name != "sig" {
+			signed[name] = values
+		}
+	}
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(escapedPath + "\n" + signed.Encode() + "\n" + clientIP))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *URLSigner) clientIP(r *http.Request) string {
+	if s.ClientIP != nil {
+		return s.ClientIP(r)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,60 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLSigner(t *testing.T) {
+	signer := &URLSigner{Keys: []SigningKey{{"2", []byte("new secret")}, {"1", []byte("old secret")}}}
+	oldSigner := &URLSigner{Keys: signer.Keys[1:]}
+	handler := signer.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	status := func(url string) int {
+		r, _ := http.NewRequest("GET", url, nil)
+		r.RemoteAddr = "192.0.2.1:4711"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	valid, _ := signer.Sign("/files/report.pdf?name=Report.pdf", time.Now().Add(time.Hour), "")
+	rotated, _ := oldSigner.Sign("/files/report.pdf", time.Now().Add(time.Hour), "")
+	unbound, _ := signer.Sign("/files/unbound.pdf", time.Now().Add(time.Hour), "198.51.100.7")
+	expired, _ := signer.Sign("/files/report.pdf", time.Now().Add(-time.Second), "")
+	for url, expected := range map[string]int{
+		valid:   http.StatusOK,
+		rotated: http.StatusOK,
+		unbound: http.StatusOK,
+		strings.Replace(valid, "report.pdf", "secret.pdf", 1): http.StatusForbidden,
+		strings.Replace(valid, "Report.pdf", "Other.pdf", 1):  http.StatusForbidden,
+		strings.Replace(valid, "kid=2", "kid=1", 1):           http.StatusForbidden,
+		expired:             http.StatusForbidden,
+		"/files/report.pdf": http.StatusForbidden,
+	} {
+		if actual := status(url); actual != expected {
+			t.Errorf("Expected %s to return %d, but was %d", url, expected, actual)
+		}
+	}
+
+	signer.BindClientIP = true
+	if actual := status(valid); actual != http.StatusForbidden {
+		t.Errorf("Expected unbound URL to be refused, but got %d", actual)
+	}
+	bound, _ := signer.Sign("/files/report.pdf", time.Now().Add(time.Hour), "192.0.2.1")
+	if actual := status(bound); actual != http.StatusOK {
+		t.Errorf("Expected URL bound to client address to pass, but got %d", actual)
+	}
+	other, _ := signer.Sign("/files/report.pdf", time.Now().Add(time.Hour), "192.0.2.2")
+	if actual := status(other); actual != http.StatusForbidden {
+		t.Errorf("Expected URL bound to another address to be refused, but got %d", actual)
+	}
+}
@@ -13,7 +13,8 @@ import (
 )
 
 type fileStaticHandler struct {
-	root http.FileSystem
+	root    http.FileSystem
+	options *FileOptions
 }
 
 // FileStaticServer returns a handler that serves HTTP requests
@@ -24,12 +25,22 @@ type fileStaticHandler struct {
 // use http.Dir:
 //
 //     http.Handle("/", http.FileStaticServer(http.Dir("/tmp")))
+//
+// Wrap root with NewCachedFileSystem to keep frequently requested files
+// in memory.
 func FileStaticServer(root http.FileSystem) http.Handler {
-	return &fileStaticHandler{root}
+	return &fileStaticHandler{root, nil}
+}
+
+// FileStaticServerWithOptions is like FileStaticServer, with files being served as
+// configured by options.
+func FileStaticServerWithOptions(root http.FileSystem, options *FileOptions) http.Handler {
+	return &fileStaticHandler{root, options}
 }
 
 func (f *fileStaticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
+	options := f.options
 	upath := r.URL.Path
 	if !strings.HasPrefix(upath, "/") {
 		upath = "/" + upath
@@ -49,10 +60,17 @@ func (f *fileStaticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("X-Content-Type-Options", "nosniff")
 		}
 
-		ServeFile(w, r, f.root, upath)
+		ServeFileWithOptions(w, r, f.root, upath, options)
 
 	}
 
+	if options != nil && options.Throttle != nil {
+		// Limit the bytes sent, not those before compression.
+		w = options.Throttle.Wrap(w, r)
+		unthrottled := *options
+		unthrottled.Throttle = nil
+		options = &unthrottled
+	}
 	MakeGzipHandler(handler)(w, r)
 
 }
@@ -0,0 +1,92 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"net/http"
+)
+
+// statusWriter records the status, the number of bytes written and the
+// first write error of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+	err     error
+}
+
+// Status returns the status code sent, which is 200 if the handler
+// wrote a body without calling WriteHeader and 0 if nothing was sent.
+func (w *statusWriter) Status() int {
+	return w.status
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// wrappingResponseWriter is a http.ResponseWriter wrapping another one,
+// which it can flush and hijack if that supports it.
+type wrappingResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	Unwrap() http.ResponseWriter
+}
+
+type responseWriterUnwrapper interface {
+	Unwrap() http.ResponseWriter
+}
+
+// exposeOptionalInterfaces returns w, implementing http.Flusher and
+// http.Hijacker only if the writer wrapped by w does, so that handlers
+// detecting these features through type assertions are not misled.
+// http.ResponseController finds them through Unwrap.
+func exposeOptionalInterfaces(w wrappingResponseWriter) http.ResponseWriter {
+	_, flusher := w.Unwrap().(http.Flusher)
+	_, hijacker := w.Unwrap().(http.Hijacker)
+	switch {
+	case flusher && hijacker:
+		return w
+	case flusher:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			responseWriterUnwrapper
+		}{w, w, w}
+	case hijacker:
+		return struct {
+			http.ResponseWriter
+			http.Hijacker
+			responseWriterUnwrapper
+		}{w, w, w}
+	default:
+		return struct {
+			http.ResponseWriter
+			responseWriterUnwrapper
+		}{w, w}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SyslogSocket is the path of the local syslog socket.
+const SyslogSocket = "/dev/log"
+
+// SyslogWriter sends entries formatted according to RFC 5424 to a local
+// syslog daemon over a Unix datagram socket. It writes entries as text
+// lines to a fallback writer when the socket is not available.
+//
+// A SyslogWriter is an io.Writer sending every write as an entry at info
+// level, so it can back a log.Logger or an AccessLogger.
+type SyslogWriter struct {
+	// Facility is the syslog facility code, 1 (user) if zero. Use 16 to
+	// 23 for local0 to local7.
+	Facility int
+
+	// AppName is the APP-NAME of entries, the name of the executable if
+	// empty.
+	AppName string
+
+	// Hostname is the HOSTNAME of entries, os.Hostname if empty.
+	Hostname string
+
+	// StructuredDataID is the SD-ID under which the attributes of slog
+	// records are sent as structured data, such as "fields@32473". If
+	// empty, they are appended to the message as key=value pairs.
+	StructuredDataID string
+
+	sink datagramSink
+}
+
+// NewSyslogWriter returns a SyslogWriter sending to the socket at path, or
+// SyslogSocket if empty. Entries which cannot be sent are written to
+// fallback, or os.Stderr if nil.
+func NewSyslogWriter(path string, fallback io.Writer) *SyslogWriter {
+	if path == "" {
+		path = SyslogSocket
+	}
+	return &SyslogWriter{sink: datagramSink{path: path, fallback: fallback}}
+}
+
+// Handler returns a slog.Handler logging to s, which can back a Logger
+// created with NewLogger.
+func (s *SyslogWriter) Handler(opts *slog.HandlerOptions) slog.Handler {
+	return newSinkHandler(s.send, opts)
+}
+
+func (s *SyslogWriter) Write(b []byte) (int, error) {
+	if err := s.send(writeRecord(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the connection to the syslog socket.
+func (s *SyslogWriter) Close() error {
+	return s.sink.close()
+}
+
+func (s *SyslogWriter) send(record *sinkRecord) error {
+	facility := s.Facility
+	if facility == 0 {
+		facility = 1
+	}
+	hostname := s.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	appName := s.AppName
+	if appName == "" {
+		appName = filepath.Base(os.Args[0])
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %d - ",
+		facility*8+severity(record.Level),
+		record.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(hostname, 255),
+		syslogHeaderField(appName, 48),
+		os.Getpid())
+
+	if s.StructuredDataID != "" && len(record.Fields) > 0 {
+		buf.WriteByte('[')
+		buf.WriteString(syslogName(s.StructuredDataID))
+		for _, field := range record.Fields {
+			fmt.Fprintf(&buf, ` %s="%s"`, syslogName(strings.Join(field.Path, ".")), syslogParamEscaper.Replace(field.Value))
+		}
+		buf.WriteByte(']')
+	} else {
+		buf.WriteByte('-')
+	}
+	if record.Message != "" {
+		buf.WriteByte(' ')
+		buf.WriteString(record.Message)
+	}
+	if s.StructuredDataID == "" {
+		appendFields(&buf, record.Fields)
+	}
+
+	return s.sink.send(func(conn *net.UnixConn) error {
+		_, err := conn.Write(buf.Bytes())
+		return err
+	}, record)
+}
+
+var syslogParamEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// syslogHeaderField returns value as header field of at most max printable
+// US-ASCII characters, or the nil value "-" if empty.
+func syslogHeaderField(value string, max int) string {
+	value = syslogName(value)
+	if len(value) > max {
+		value = value[:max]
+	}
+	return value
+}
+
+// syslogName replaces characters not allowed in names of RFC 5424 with
+// underscores, returning "-" for an empty name.
+func syslogName(name string) string {
+	if name == "" {
+		return "-"
+	}
+	b := []byte(name)
+	for i, c := range b {
+		if c <= ' ' || c >= 0x7f || c == '=' || c == ']' || c == '"' {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,197 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimiter is a token bucket limiting throughput to a number of bytes
+// per second, allowing bursts of up to one second worth of data.
+//
+// The rate may be changed at any time, zero or less means unlimited.
+type RateLimiter struct {
+	mutex  sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing bytesPerSecond.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	return &RateLimiter{
+		rate:   bytesPerSecond,
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// SetRate changes the rate of l to bytesPerSecond.
+func (l *RateLimiter) SetRate(bytesPerSecond int64) {
+	l.mutex.Lock()
+	l.refill(time.Now())
+	l.rate = bytesPerSecond
+	if l.tokens > float64(bytesPerSecond) {
+		l.tokens = float64(bytesPerSecond)
+	}
+	l.mutex.Unlock()
+}
+
+// Rate returns the current rate of l in bytes per second.
+func (l *RateLimiter) Rate() int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.rate
+}
+
+// Wait blocks until n bytes may be sent, or ctx is done. Waiting for more
+// than the rate at once takes correspondingly longer than a second.
+func (l *RateLimiter) Wait(ctx context.Context, n int) error {
+	delay := l.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve takes n tokens from the bucket and returns how long to wait
+// until they are actually available.
+func (l *RateLimiter) reserve(n int) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.rate <= 0 {
+		return 0
+	}
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+}
+
+func (l *RateLimiter) refill(now time.Time) {
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		if l.tokens > float64(l.rate) {
+			l.tokens = float64(l.rate)
+		}
+	}
+	l.last = now
+}
+
+// Throttle limits the bandwidth used by responses, both for each single
+// response and in total for all responses using it. The limits are given
+// in bytes per second and may be changed at any time, also affecting
+// responses in progress. Zero or less means unlimited.
+type Throttle struct {
+	global       *RateLimiter
+	responseRate int64
+}
+
+// NewThrottle returns a Throttle with the given limits.
+func NewThrottle(globalRate, responseRate int64) *Throttle {
+	return &Throttle{
+		global:       NewRateLimiter(globalRate),
+		responseRate: responseRate,
+	}
+}
+
+// SetGlobalRate changes the limit for all responses.
+func (t *Throttle) SetGlobalRate(bytesPerSecond int64) {
+	t.global.SetRate(bytesPerSecond)
+}
+
+// SetResponseRate changes the limit for each response.
+func (t *Throttle) SetResponseRate(bytesPerSecond int64) {
+	atomic.StoreInt64(&t.responseRate, bytesPerSecond)
+}
+
+// Handler returns a handler which runs h with its output throttled.
+func (t *Throttle) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(t.Wrap(w, r), r)
+	})
+}
+
+// Wrap returns a http.ResponseWriter writing to w as fast as the limits
+// allow. Waiting is aborted once r is canceled.
+func (t *Throttle) Wrap(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	rate := atomic.LoadInt64(&t.responseRate)
+	return &throttledResponseWriter{
+		ResponseWriter: w,
+		ctx:            r.Context(),
+		throttle:       t,
+		limiter:        NewRateLimiter(rate),
+		rate:           rate,
+	}
+}
+
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	throttle *Throttle
+	limiter  *RateLimiter
+	rate     int64
+}
+
+func (w *throttledResponseWriter) Write(b []byte) (int, error) {
+	if rate := atomic.LoadInt64(&w.throttle.responseRate); rate != w.rate {
+		w.limiter.SetRate(rate)
+		w.rate = rate
+	}
+	written := 0
+	for len(b) > 0 {
+		chunk := w.chunkSize()
+		if chunk > len(b) {
+			chunk = len(b)
+		}
+		if err := w.limiter.Wait(w.ctx, chunk); err != nil {
+			return written, err
+		}
+		if err := w.throttle.global.Wait(w.ctx, chunk); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(b[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[chunk:]
+	}
+	return written, nil
+}
+
+func (w *throttledResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// chunkSize returns how much to write at once, small enough to keep the
+// output smooth at the current rates.
+func (w *throttledResponseWriter) chunkSize() int {
+	chunk := int64(32 * 1024)
+	for _, rate := range []int64{w.rate, w.throttle.global.Rate()} {
+		if rate > 0 && rate/8 < chunk {
+			chunk = rate / 8
+		}
+	}
+	if chunk < 1 {
+		chunk = 1
+	}
+	return int(chunk)
+}
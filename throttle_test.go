@@ -0,0 +1,71 @@
+// Copyright 2014 struktur AG. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServeFileWithOptions_Throttle(t *testing.T) {
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789"), 15000)
+	ioutil.WriteFile(filepath.Join(dir, "large.bin"), content, 0644)
+	options := &FileOptions{Throttle: NewThrottle(0, 100000)}
+
+	serve := func(rangeHeader string) (*httptest.ResponseRecorder, time.Duration) {
+		r, _ := http.NewRequest("GET", "/large.bin", nil)
+		if rangeHeader != "" {
+			r.Header.Set("Range", rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		start := time.Now()
+		ServeFileWithOptions(w, r, http.Dir(dir), "/large.bin", options)
+		return w, time.Since(start)
+	}
+
+	// The first 100000 bytes are sent as burst, the remainder takes half
+	// a second.
+	w, elapsed := serve("")
+	if !bytes.Equal(w.Body.Bytes(), content) {
+		t.Error("Throttled response does not match file content")
+	}
+	if elapsed < 400*time.Millisecond {
+		t.Errorf("Expected throttled response to take about 500ms, but took %v", elapsed)
+	}
+
+	options.Throttle.SetResponseRate(0)
+	w, elapsed = serve("bytes=100-149999")
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), content[100:]) {
+		t.Errorf("Expected partial content, but got %d", w.Code)
+	}
+	if elapsed > 200*time.Millisecond {
+		t.Errorf("Expected unlimited response to be fast, but took %v", elapsed)
+	}
+}
+
+func TestFileStaticServerWithOptions_ThrottlesCompressedBytes(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "large.txt"), bytes.Repeat([]byte("0123456789"), 15000), 0644)
+	handler := FileStaticServerWithOptions(http.Dir(dir), &FileOptions{Throttle: NewThrottle(0, 100000)})
+
+	r, _ := http.NewRequest("GET", "/large.txt", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("Expected compressed response")
+	}
+	// Compressed, the response fits into the initial burst.
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("Expected throttle to apply to compressed bytes, but took %v", elapsed)
+	}
+}
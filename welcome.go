@@ -5,8 +5,14 @@
 package httputils
 
 import (
+	"bytes"
 	"encoding/json"
+	"html/template"
 	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
 )
 
 // The conventional path at which the handler returned by MakeWelcomeHandler
@@ -27,3 +33,229 @@ func MakeWelcomeHandler(name, version string) http.HandlerFunc {
 		json.NewEncoder(w).Encode(response)
 	}
 }
+
+// BuildTime is reported by MakeExtendedWelcomeHandler as build time. It can
+// be set at link time, for example with
+//
+//	go build -ldflags "-X github.com/strukturag/httputils.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// If empty, the commit time recorded by the Go toolchain is used instead.
+var BuildTime string
+
+var startTime = time.Now()
+
+// WelcomeInfo selects the details added by MakeExtendedWelcomeHandler.
+type WelcomeInfo struct {
+	// Revision adds the VCS revision as "revision" and whether the working
+	// tree had local modifications as "modified".
+	Revision bool
+
+	// BuildTime adds BuildTime as "build_time".
+	BuildTime bool
+
+	// ModuleVersion adds the version of the main module as
+	// "module_version".
+	ModuleVersion bool
+
+	// GoVersion adds the Go version used for building as "go_version".
+	GoVersion bool
+
+	// StartTime adds the start time of the process as "start_time".
+	StartTime bool
+
+	// Uptime adds the seconds since the start of the process as "uptime".
+	// Note that this changes the ETag of the response every second.
+	Uptime bool
+}
+
+// MakeExtendedWelcomeHandler returns an HTTP handler which renders a JSON
+// response like MakeWelcomeHandler, extended with the details selected by
+// info. Build details are taken from runtime/debug.ReadBuildInfo, those
+// which are unknown are left out.
+//
+// Responses carry an ETag, so clients polling the handler can use
+// conditional requests.
+func MakeExtendedWelcomeHandler(name, version string, info WelcomeInfo) http.HandlerFunc {
+	return NewWelcomeBuilder(name, version).Info(info).Handler()
+}
+
+// WelcomeBuilder assembles the document served by a welcome handler from
+// the application name and version and any number of further fields.
+//
+// The handler renders JSON by default and a small HTML page for clients
+// preferring text/html, such as browsers. It answers GET, HEAD and OPTIONS
+// requests and rejects other methods with 405 Method Not Allowed.
+type WelcomeBuilder struct {
+	// ProblemDetails makes the handler write errors as RFC 9457 problem
+	// details instead of plain text.
+	ProblemDetails bool
+
+	name   string
+	fields []welcomeField
+}
+
+type welcomeField struct {
+	key     string
+	value   interface{}
+	dynamic func(r *http.Request) interface{}
+}
+
+// NewWelcomeBuilder returns a WelcomeBuilder with the fields of
+// MakeWelcomeHandler.
+func NewWelcomeBuilder(name, version string) *WelcomeBuilder {
+	b := &WelcomeBuilder{name: name}
+	return b.Set(name, "Welcome").Set("version", version)
+}
+
+// Set adds a field with a static value, which must be encodable as JSON.
+// Setting a key again replaces its value.
+func (b *WelcomeBuilder) Set(key string, value interface{}) *WelcomeBuilder {
+	return b.set(welcomeField{key: key, value: value})
+}
+
+// SetFunc adds a field whose value is computed by fn for every request.
+func (b *WelcomeBuilder) SetFunc(key string, fn func(r *http.Request) interface{}) *WelcomeBuilder {
+	return b.set(welcomeField{key: key, dynamic: fn})
+}
+
+func (b *WelcomeBuilder) set(field welcomeField) *WelcomeBuilder {
+	for i := range b.fields {
+		if b.fields[i].key == field.key {
+			b.fields[i] = field
+			return b
+		}
+	}
+	b.fields = append(b.fields, field)
+	return b
+}
+
+// Info adds the build and runtime details selected by info, as described
+// for MakeExtendedWelcomeHandler.
+func (b *WelcomeBuilder) Info(info WelcomeInfo) *WelcomeBuilder {
+	buildInfo, ok := debug.ReadBuildInfo()
+	if ok {
+		settings := make(map[string]string)
+		for _, setting := range buildInfo.Settings {
+			settings[setting.Key] = setting.Value
+		}
+		if revision := settings["vcs.revision"]; info.Revision && revision != "" {
+			b.Set("revision", revision)
+			b.Set("modified", settings["vcs.modified"] == "true")
+		}
+		if info.ModuleVersion && buildInfo.Main.Version != "" {
+			b.Set("module_version", buildInfo.Main.Version)
+		}
+		if info.GoVersion {
+			b.Set("go_version", buildInfo.GoVersion)
+		}
+		if info.BuildTime && BuildTime == "" && settings["vcs.time"] != "" {
+			b.Set("build_time", settings["vcs.time"])
+		}
+	} else if info.GoVersion {
+		b.Set("go_version", runtime.Version())
+	}
+	if info.BuildTime && BuildTime != "" {
+		b.Set("build_time", BuildTime)
+	}
+	if info.StartTime {
+		b.Set("start_time", startTime.UTC().Format(time.RFC3339))
+	}
+	if info.Uptime {
+		b.SetFunc("uptime", func(r *http.Request) interface{} {
+			return int64(time.Since(startTime) / time.Second)
+		})
+	}
+	return b
+}
+
+var welcomeTemplate = template.Must(template.New("welcome").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<dl>
+{{range .Fields}}<dt>{{.Key}}</dt><dd>{{if .Link}}<a href="{{.Value}}">{{.Value}}</a>{{else}}{{.Value}}{{end}}</dd>
+{{end}}</dl>
+</body>
+</html>
+`))
+
+type welcomeHTMLField struct {
+	Key, Value string
+	Link       bool
+}
+
+// Handler returns an HTTP handler serving the document. Responses carry an
+// ETag, so clients polling the handler can use conditional requests.
+func (b *WelcomeBuilder) Handler() http.HandlerFunc {
+	name := b.name
+	fields := make([]welcomeField, len(b.fields))
+	copy(fields, b.fields)
+	problemDetails := b.ProblemDetails
+	const allow = "GET, HEAD, OPTIONS"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		switch r.Method {
+		case "", "GET", "HEAD":
+		case "OPTIONS":
+			h.Set("Allow", allow)
+			h.Set("Content-Length", "0")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			h.Set("Allow", allow)
+			httpError(w, r, http.StatusMethodNotAllowed, problemDetails)
+			return
+		}
+
+		values := make([]interface{}, len(fields))
+		for i, field := range fields {
+			if field.dynamic != nil {
+				values[i] = field.dynamic(r)
+			} else {
+				values[i] = field.value
+			}
+		}
+
+		var buf bytes.Buffer
+		addVary(h, "Accept")
+		if format, _ := Negotiate(r, "application/json", "text/html"); format == "text/html" {
+			data := struct {
+				Name   string
+				Fields []welcomeHTMLField
+			}{Name: name}
+			for i, field := range fields {
+				value, ok := values[i].(string)
+				if !ok {
+					encoded, _ := json.Marshal(values[i])
+					value = string(encoded)
+				}
+				link := ok && (strings.HasPrefix(value, "/") || strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://"))
+				data.Fields = append(data.Fields, welcomeHTMLField{Key: field.key, Value: value, Link: link})
+			}
+			if err := welcomeTemplate.Execute(&buf, data); err != nil {
+				httpError(w, r, http.StatusInternalServerError, problemDetails)
+				return
+			}
+			h.Set("Content-Type", "text/html; charset=utf-8")
+		} else {
+			body := make(map[string]interface{}, len(fields))
+			for i, field := range fields {
+				body[field.key] = values[i]
+			}
+			if err := json.NewEncoder(&buf).Encode(body); err != nil {
+				httpError(w, r, http.StatusInternalServerError, problemDetails)
+				return
+			}
+			h.Set("Content-Type", "application/json")
+		}
+
+		h.Set("Cache-Control", "no-cache")
+		h.Set("ETag", contentETag(buf.Bytes()))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+	}
+}
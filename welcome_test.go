@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -41,3 +42,91 @@ func TestMakeWelcomeHandler(t *testing.T) {
 		t.Errorf("Expected key '%s' to have value '%s', but was '%s'", key, expected, actual)
 	}
 }
+
+func TestMakeExtendedWelcomeHandler(t *testing.T) {
+	handler := MakeExtendedWelcomeHandler("spreed-app", "0.8.3", WelcomeInfo{GoVersion: true, StartTime: true})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to unmarshall json: %v", err)
+	}
+	for _, key := range []string{"spreed-app", "version", "go_version", "start_time"} {
+		if _, ok := body[key]; !ok {
+			t.Errorf("Expected key '%s' to be present in %v", key, body)
+		}
+	}
+	if _, ok := body["uptime"]; ok {
+		t.Error("Expected uptime not to be present")
+	}
+
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected ETag to be set")
+	}
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected response status to be %d, but was %d", http.StatusNotModified, w.Code)
+	}
+}
+
+func TestWelcomeBuilder(t *testing.T) {
+	handler := NewWelcomeBuilder("spreed-app", "0.8.3").
+		Set("features", []string{"rooms", "files"}).
+		Set("api", "/api/v1").
+		SetFunc("client", func(r *http.Request) interface{} { return r.UserAgent() }).
+		Handler()
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", "test")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected JSON response, but was %s", contentType)
+	}
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to unmarshall json: %v", err)
+	}
+	if body["client"] != "test" || body["version"] != "0.8.3" || len(body["features"].([]interface{})) != 2 {
+		t.Errorf("Unexpected body %v", body)
+	}
+
+	r.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Errorf("Expected HTML response, but was %s", contentType)
+	}
+	if html := w.Body.String(); !strings.Contains(html, `<a href="/api/v1">/api/v1</a>`) || !strings.Contains(html, `[&#34;rooms&#34;,&#34;files&#34;]`) {
+		t.Errorf("Unexpected HTML %s", html)
+	}
+}
+
+func TestWelcomeBuilderMethods(t *testing.T) {
+	handler := NewWelcomeBuilder("spreed-app", "0.8.3").Handler()
+
+	for method, expected := range map[string]int{
+		"HEAD":    http.StatusOK,
+		"OPTIONS": http.StatusNoContent,
+		"POST":    http.StatusMethodNotAllowed,
+	} {
+		r, _ := http.NewRequest(method, "/", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != expected {
+			t.Errorf("Expected response status to %s to be %d, but was %d", method, expected, w.Code)
+		}
+		if method == "HEAD" && w.Body.Len() != 0 {
+			t.Errorf("Expected empty body for HEAD, but was %q", w.Body.String())
+		}
+		if method != "HEAD" && w.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+			t.Errorf("Expected Allow header for %s, but was %q", method, w.Header().Get("Allow"))
+		}
+	}
+}